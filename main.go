@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"os"
 
 	"github.com/spf13/cobra"
 
@@ -10,12 +10,18 @@ import (
 	"github.com/iftechio/jki/pkg/cmd/config"
 	"github.com/iftechio/jki/pkg/cmd/cp"
 	"github.com/iftechio/jki/pkg/cmd/deploy"
+	"github.com/iftechio/jki/pkg/cmd/load"
+	"github.com/iftechio/jki/pkg/cmd/outdated"
+	"github.com/iftechio/jki/pkg/cmd/pin"
+	"github.com/iftechio/jki/pkg/cmd/promote"
 	"github.com/iftechio/jki/pkg/cmd/pull"
+	"github.com/iftechio/jki/pkg/cmd/save"
 	"github.com/iftechio/jki/pkg/cmd/transferimage"
 	"github.com/iftechio/jki/pkg/cmd/upgrade"
 	"github.com/iftechio/jki/pkg/cmd/version"
 	"github.com/iftechio/jki/pkg/configflags"
 	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/utils"
 )
 
 type Commander func(factory.Factory) *cobra.Command
@@ -35,7 +41,12 @@ func main() {
 		config.NewCmdConfig,
 		cp.NewCmdCp,
 		deploy.NewCmdDeploy,
+		load.NewCmdLoad,
+		outdated.NewCmdOutdated,
+		pin.NewCmdPin,
+		promote.NewCmdPromote,
 		pull.NewCmdPull,
+		save.NewCmdSave,
 		transferimage.NewCmdTransferImage,
 		upgrade.NewCmdUpgrade,
 		version.NewCmdVersion,
@@ -45,8 +56,13 @@ func main() {
 		rootCmd.AddCommand(c(f))
 	}
 
-	err := rootCmd.Execute()
-	if err != nil {
-		log.Fatal(err)
+	// timings are printed on failures too, where they show what took the time
+	printTimings := func() {
+		if timings := cf.Timings(); timings != nil {
+			timings.Print(os.Stderr)
+		}
 	}
+	utils.BeforeExit(printTimings)
+	utils.CheckError(rootCmd.Execute())
+	printTimings()
 }
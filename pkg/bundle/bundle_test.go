@@ -0,0 +1,198 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func descOf(data []byte) ocispec.Descriptor {
+	return ocispec.Descriptor{Digest: digest.FromBytes(data), Size: int64(len(data))}
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, r *Reader, name string) []byte {
+	sr, err := r.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("uncompressed layer")
+	manifest := []byte(`{"schemaVersion":2}`)
+	configDesc, layerDesc, manifestDesc := descOf(config), descOf(layer), descOf(manifest)
+
+	dir, err := ioutil.TempDir("", "jki-bundle-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "bundle.tar")
+	f, err := os.Create(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(f)
+	for _, blob := range []struct {
+		desc ocispec.Descriptor
+		data []byte
+	}{{configDesc, config}, {layerDesc, layer}, {manifestDesc, manifest}, {configDesc, config}} {
+		if err := w.WriteBlob(blob.desc, bytes.NewReader(blob.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteBlob(descOf([]byte("other")), bytes.NewReader([]byte("wrong"))); err == nil {
+		t.Errorf("expected digest mismatch")
+	}
+	w.AddImage("registry.example.com/foo/app:v1", "v1", manifestDesc)
+	w.AddDockerImage("registry.example.com/foo/app:v1", configDesc, []ocispec.Descriptor{layerDesc})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	images, err := r.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].Name != "registry.example.com/foo/app:v1" || images[0].Desc.Digest != manifestDesc.Digest ||
+		images[0].Desc.Annotations[ocispec.AnnotationRefName] != "v1" {
+		t.Errorf("unexpected images from index.json: %+v", images)
+	}
+	if data := readAll(t, r, "blobs/sha256/"+layerDesc.Digest.Hex()); !bytes.Equal(data, layer) {
+		t.Errorf("unexpected layer blob: %q", data)
+	}
+	var layout ocispec.ImageLayout
+	if err := json.Unmarshal(readAll(t, r, "oci-layout"), &layout); err != nil || layout.Version != ocispec.ImageLayoutVersion {
+		t.Errorf("unexpected oci-layout: %+v %v", layout, err)
+	}
+
+	// docker load reads manifest.json with paths of blobs
+	var entries []dockerManifestEntry
+	if err := json.Unmarshal(readAll(t, r, "manifest.json"), &entries); err != nil {
+		t.Fatal(err)
+	}
+	expected := []dockerManifestEntry{{
+		Config:   "blobs/sha256/" + configDesc.Digest.Hex(),
+		RepoTags: []string{"registry.example.com/foo/app:v1"},
+		Layers:   []string{"blobs/sha256/" + layerDesc.Digest.Hex()},
+	}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, entries)
+	}
+
+	// uncompressed layers are gzipped
+	desc, rc, err := r.Layer(entries[0].Layers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	if desc.Digest != digest.FromBytes(data) || desc.Size != int64(len(data)) {
+		t.Errorf("descriptor %+v does not match the content", desc)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(zr); !bytes.Equal(data, layer) {
+		t.Errorf("unexpected gunzipped layer: %q", data)
+	}
+}
+
+func TestDockerArchive(t *testing.T) {
+	t.Parallel()
+	layer := gzipped(t, []byte("compressed layer"))
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"manifest.json", []byte(`[{"Config":"abc.json","RepoTags":["foo:v1","foo:latest"],"Layers":["l1/layer.tar"]}]`)},
+		{"abc.json", []byte(`{}`)},
+		{"l1/layer.tar", layer},
+	}
+	dir, err := ioutil.TempDir("", "jki-bundle-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "docker.tar")
+	f, err := os.Create(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for _, file := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	images, err := r.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Image{
+		{Name: "foo:v1", Config: "abc.json", Layers: []string{"l1/layer.tar"}},
+		{Name: "foo:latest", Config: "abc.json", Layers: []string{"l1/layer.tar"}},
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, images)
+	}
+
+	// gzipped layers are kept as is
+	desc, rc, err := r.Layer("l1/layer.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if data, _ := ioutil.ReadAll(rc); !bytes.Equal(data, layer) || desc.Digest != digest.FromBytes(layer) {
+		t.Errorf("unexpected layer: %+v", desc)
+	}
+}
@@ -0,0 +1,197 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Image is an image found in a bundle.
+type Image struct {
+	Name string
+
+	// Desc is the manifest or index of images from OCI image layouts.
+	Desc *ocispec.Descriptor
+
+	// Config and Layers are file names of images from docker-archive tarballs.
+	Config string
+	Layers []string
+}
+
+type entry struct {
+	offset int64
+	size   int64
+}
+
+// Reader reads OCI image layout and docker-archive tarballs without extracting them.
+type Reader struct {
+	f       *os.File
+	entries map[string]entry
+}
+
+func Open(fp string) (*Reader, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{
+		f:       f,
+		entries: make(map[string]entry),
+	}
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("read %s: %s", fp, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		r.entries[path.Clean(hdr.Name)] = entry{offset: offset, size: hdr.Size}
+	}
+	return r, nil
+}
+
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
+
+// Open returns the content of the file `name` in the tarball.
+func (r *Reader) Open(name string) (*io.SectionReader, error) {
+	e, ok := r.entries[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in bundle", name)
+	}
+	return io.NewSectionReader(r.f, e.offset, e.size), nil
+}
+
+// Blob returns the content of the blob `dgst` of OCI image layouts.
+func (r *Reader) Blob(dgst digest.Digest) (*io.SectionReader, error) {
+	return r.Open(blobPath(dgst))
+}
+
+// tempFile is a temporary file removed on Close.
+type tempFile struct {
+	*os.File
+}
+
+func (f tempFile) Close() error {
+	f.File.Close()
+	return os.Remove(f.Name())
+}
+
+// Layer returns the descriptor and content of the layer `name` of docker-archive tarballs,
+// gzipped since registries expect compressed layers. Layers already gzipped are returned as is,
+// others are compressed into a temporary file removed by closing the content.
+func (r *Reader) Layer(name string) (ocispec.Descriptor, io.ReadCloser, error) {
+	sr, err := r.Open(name)
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	magic := make([]byte, 2)
+	if _, err := sr.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return ocispec.Descriptor{}, nil, err
+	}
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		dgst, err := digest.FromReader(io.NewSectionReader(sr, 0, sr.Size()))
+		if err != nil {
+			return ocispec.Descriptor{}, nil, err
+		}
+		return ocispec.Descriptor{Digest: dgst, Size: sr.Size()}, ioutil.NopCloser(sr), nil
+	}
+
+	f, err := ioutil.TempFile("", "jki-layer-")
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	tmp := tempFile{f}
+	desc, err := compress(tmp.File, sr)
+	if err != nil {
+		tmp.Close()
+		return ocispec.Descriptor{}, nil, err
+	}
+	return desc, tmp, nil
+}
+
+// compress writes r gzipped to f and rewinds f.
+func compress(f *os.File, r io.Reader) (ocispec.Descriptor, error) {
+	digester := digest.Canonical.Digester()
+	bw := bufio.NewWriter(io.MultiWriter(f, digester.Hash()))
+	gw := gzip.NewWriter(bw)
+	if _, err := io.Copy(gw, r); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := gw.Close(); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if err := bw.Flush(); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return ocispec.Descriptor{Digest: digester.Digest(), Size: size}, nil
+}
+
+func (r *Reader) readJSON(name string, v interface{}) error {
+	sr, err := r.Open(name)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(sr).Decode(v)
+}
+
+// Images lists images in the bundle, preferring `index.json` over `manifest.json`.
+func (r *Reader) Images() ([]Image, error) {
+	var images []Image
+	if _, ok := r.entries[indexFile]; ok {
+		var index ocispec.Index
+		if err := r.readJSON(indexFile, &index); err != nil {
+			return nil, fmt.Errorf("decode %s: %s", indexFile, err)
+		}
+		for i := range index.Manifests {
+			desc := index.Manifests[i]
+			name := desc.Annotations[AnnotationImageName]
+			if len(name) == 0 {
+				name = desc.Annotations[ocispec.AnnotationRefName]
+			}
+			images = append(images, Image{Name: name, Desc: &desc})
+		}
+		return images, nil
+	}
+	if _, ok := r.entries[dockerManifestFile]; ok {
+		var entries []dockerManifestEntry
+		if err := r.readJSON(dockerManifestFile, &entries); err != nil {
+			return nil, fmt.Errorf("decode %s: %s", dockerManifestFile, err)
+		}
+		for _, e := range entries {
+			for _, name := range e.RepoTags {
+				images = append(images, Image{Name: name, Config: e.Config, Layers: e.Layers})
+			}
+		}
+		return images, nil
+	}
+	return nil, fmt.Errorf("neither %s nor %s found, not an image bundle", indexFile, dockerManifestFile)
+}
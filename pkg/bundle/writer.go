@@ -0,0 +1,137 @@
+package bundle
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	// AnnotationImageName keeps the full name of the saved image, the same key containerd uses.
+	AnnotationImageName = "io.containerd.image.name"
+
+	indexFile          = "index.json"
+	layoutFile         = "oci-layout"
+	dockerManifestFile = "manifest.json"
+)
+
+// dockerManifestEntry is an entry of `manifest.json` in docker-archive tarballs.
+type dockerManifestEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// Writer writes images into a tarball which is both an OCI image layout and a docker-archive.
+type Writer struct {
+	tw      *tar.Writer
+	written map[digest.Digest]struct{}
+	index   ocispec.Index
+	docker  []dockerManifestEntry
+}
+
+func NewWriter(w io.Writer) *Writer {
+	bw := &Writer{
+		tw:      tar.NewWriter(w),
+		written: make(map[digest.Digest]struct{}),
+	}
+	bw.index.SchemaVersion = 2
+	return bw
+}
+
+func blobPath(dgst digest.Digest) string {
+	return fmt.Sprintf("blobs/%s/%s", dgst.Algorithm(), dgst.Hex())
+}
+
+// HasBlob reports whether the blob has been written.
+func (w *Writer) HasBlob(dgst digest.Digest) bool {
+	_, ok := w.written[dgst]
+	return ok
+}
+
+// WriteBlob writes the content of desc read from r, verifying its digest.
+func (w *Writer) WriteBlob(desc ocispec.Descriptor, r io.Reader) error {
+	if w.HasBlob(desc.Digest) {
+		return nil
+	}
+	err := w.tw.WriteHeader(&tar.Header{
+		Name:     blobPath(desc.Digest),
+		Mode:     0444,
+		Size:     desc.Size,
+		Typeflag: tar.TypeReg,
+		ModTime:  time.Unix(0, 0),
+	})
+	if err != nil {
+		return err
+	}
+	verifier := desc.Digest.Verifier()
+	if _, err := io.CopyN(w.tw, io.TeeReader(r, verifier), desc.Size); err != nil {
+		return fmt.Errorf("write blob %s: %s", desc.Digest, err)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("digest mismatch: %s", desc.Digest)
+	}
+	w.written[desc.Digest] = struct{}{}
+	return nil
+}
+
+// AddImage records the manifest or index `desc` as the image `name` in `index.json`.
+func (w *Writer) AddImage(name, tag string, desc ocispec.Descriptor) {
+	desc.Annotations = map[string]string{
+		AnnotationImageName:       name,
+		ocispec.AnnotationRefName: tag,
+	}
+	w.index.Manifests = append(w.index.Manifests, desc)
+}
+
+// AddDockerImage records the image `name` in `manifest.json` so that `docker load` understands the tarball.
+func (w *Writer) AddDockerImage(name string, config ocispec.Descriptor, layers []ocispec.Descriptor) {
+	entry := dockerManifestEntry{
+		Config:   blobPath(config.Digest),
+		RepoTags: []string{name},
+	}
+	for _, l := range layers {
+		entry.Layers = append(entry.Layers, blobPath(l.Digest))
+	}
+	w.docker = append(w.docker, entry)
+}
+
+func (w *Writer) writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = w.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0444,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+		ModTime:  time.Unix(0, 0),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.tw.Write(data)
+	return err
+}
+
+// Close writes the indexes and flushes the tarball. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.writeJSON(layoutFile, ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion}); err != nil {
+		return err
+	}
+	if err := w.writeJSON(indexFile, w.index); err != nil {
+		return err
+	}
+	if len(w.docker) != 0 {
+		if err := w.writeJSON(dockerManifestFile, w.docker); err != nil {
+			return err
+		}
+	}
+	return w.tw.Close()
+}
@@ -1,8 +1,11 @@
 package build
 
 import (
+	"archive/tar"
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -10,6 +13,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/docker/docker/api/types"
@@ -17,16 +21,29 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/docker/docker/pkg/term"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/iftechio/jki/pkg/cmd/deploy"
+	"github.com/iftechio/jki/pkg/config"
+	"github.com/iftechio/jki/pkg/dockerfile"
 	"github.com/iftechio/jki/pkg/factory"
-	"github.com/iftechio/jki/pkg/git"
+	"github.com/iftechio/jki/pkg/hook"
+	imageutil "github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/imagetag"
+	"github.com/iftechio/jki/pkg/notify"
+	"github.com/iftechio/jki/pkg/progress"
+	"github.com/iftechio/jki/pkg/project"
 	"github.com/iftechio/jki/pkg/registry"
 	"github.com/iftechio/jki/pkg/utils"
 )
 
 func notifyUser(msg, title string) error {
+	if !hasTTY {
+		return nil
+	}
 	var cmd *exec.Cmd
 	switch runtime.GOOS {
 	case "linux":
@@ -40,22 +57,75 @@ func notifyUser(msg, title string) error {
 }
 
 type Options struct {
-	context         string
-	dockerFileName  string
+	context        string
+	dockerFileName string
+	// ignoreFor is the Dockerfile `<Dockerfile>.dockerignore` is looked up for, if dockerFileName
+	// is a rewritten copy of it
+	ignoreFor string
+	// tmpContext is the directory the context is cloned or extracted to
+	tmpContext string
+	// archived is set if the context is extracted from a tarball or stdin, which is not in the
+	// git repository of the working directory
+	archived        bool
 	imageName       string
 	tagName         string
+	extraTags       []string
+	tagTemplate     string
+	target          string
+	output          string
 	buildArgs       []string
 	labels          []string
+	noProvenance    bool
 	disableBuildKit bool
+	builder         string
 	noConfirm       bool
 	noPush          bool
+	skipExisting    bool
 	noCache         bool
 	pull            bool
 	platform        string
+	platforms       []string
+	cacheFrom       []string
+	cacheTo         string
+	secretFlags     []string
+	sshFlags        []string
+	metadataFile    string
+	explainContext  bool
+	format          string
+	compare         string
+
+	outputs       []types.ImageBuildOutput
+	secrets       []config.Secret
+	sshConfigs    []sshprovider.AgentConfig
+	cacheFromRefs []string
+	cacheToRefs   []string
+	inlineCache   bool
+	cacheExports  []bkclient.CacheOptionsEntry
+
+	all      bool
+	since    string
+	parallel int
 
-	dstRegistry   *registry.Registry
-	allRegistries map[string]*registry.Registry
-	dockerClient  *client.Client
+	project              *project.Project
+	deployTargets        []project.DeployTarget
+	projectImages        []string
+	projectRegistries    []string
+	useProjectRegistries bool
+	progress             progress.Mode
+	timings              *progress.Timings
+	stats                *buildStats
+	stdout               io.Writer
+	out                  *os.File // progress and messages, stderr with --output-format json
+	dstRegistries        []*registry.Registry
+	allRegistries        map[string]*registry.Registry
+	dockerClient         *client.Client
+	bkClient             *bkclient.Client
+	config               *config.Config
+	notifier             *notify.Notifier
+	hooks                *hook.Runner
+	resolver             *registry.Resolver
+	// deployedImage returns the image deployed to the first of deploy targets of the image
+	deployedImage func(name string, targets []project.DeployTarget) (string, error)
 }
 
 func NewBuildOptions() *Options {
@@ -63,13 +133,112 @@ func NewBuildOptions() *Options {
 }
 
 func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
-	var err error
-	if len(args) > 1 {
-		o.context, err = filepath.Abs(args[0])
+	fromArgs, err := o.completeContext(cmd, args)
+	if err != nil {
+		return err
+	}
+	if err := o.completeProject(cmd, args); err != nil {
+		return err
+	}
+	if !fromArgs && len(args) != 0 && len(o.projectImages) == 0 {
+		return fmt.Errorf("invalid build context or image name: %s", strings.Join(args, " "))
+	}
+	if len(o.builder) != 0 {
+		addr, err := builderAddress(o.builder)
+		if err != nil {
+			return err
+		}
+		o.bkClient, err = bkclient.New(context.TODO(), addr, bkclient.WithFailFast())
+		if err != nil {
+			return fmt.Errorf("connect to buildkitd: %s", err)
+		}
+	} else if err := o.completeDockerClient(f); err != nil {
+		return err
+	}
+	o.progress, err = f.Progress()
+	if err != nil {
+		return err
+	}
+	o.timings = f.Timings()
+	targets, registries, err := f.LoadTargetRegistries()
+	if err != nil {
+		return err
+	}
+	if strings.IndexFunc(o.imageName, unicode.IsUpper) != -1 {
+		o.imageName = strings.ToLower(o.imageName)
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: uppercase char is not allowed in image name, changed to `%s`\n", o.imageName)
+	}
+	if len(o.projectRegistries) != 0 {
+		targets = o.projectRegistries
+	}
+	for _, name := range targets {
+		if _, exist := registries[name]; !exist {
+			return fmt.Errorf("registry not found: %s", name)
+		}
+		o.dstRegistries = append(o.dstRegistries, registries[name])
+	}
+	if err := o.completeCacheOptions(); err != nil {
+		return err
+	}
+	cfg, err := f.LoadConfig()
+	if err != nil {
+		return err
+	}
+	o.config = cfg
+	o.notifier, err = notify.New(cfg.Notifications)
+	if err != nil {
+		return err
+	}
+	p := o.project
+	if p != nil && len(o.tmpContext) != 0 {
+		// hooks run on the host, unlike RUN instructions of the Dockerfile
+		if !p.Hooks.Empty() {
+			_, _ = fmt.Fprintln(os.Stderr, "WARNING: hooks in the project file of a git or tarball context are not run")
+		}
+		p = nil
+	}
+	o.hooks = hook.New(cfg, p)
+	o.resolver, err = f.ToResolver()
+	if err != nil {
+		return err
+	}
+	if o.compare == compareDeployed {
+		o.deployedImage = func(name string, targets []project.DeployTarget) (string, error) {
+			return deploy.DeployedImage(f, name, targets)
+		}
+	}
+	for _, s := range o.secretFlags {
+		secret, err := parseSecret(s)
+		if err != nil {
+			return err
+		}
+		o.secrets = append(o.secrets, secret)
+	}
+	for _, s := range o.sshFlags {
+		o.sshConfigs = append(o.sshConfigs, parseSSH(s))
+	}
+	if len(o.output) != 0 {
+		out, err := parseOutput(o.output)
 		if err != nil {
-			return fmt.Errorf("failed to resolve absolute path: %s", err)
+			return err
 		}
+		o.outputs = []types.ImageBuildOutput{out}
+		// build results are exported to local files instead of images
+		o.noPush = true
 	}
+	o.allRegistries = registries
+	if len(o.platforms) == 1 {
+		o.platform = o.platforms[0]
+	} else {
+		o.platform = f.Platform()
+	}
+	return nil
+}
+
+// completeDockerClient connects to the docker daemon and falls back to the legacy builder if
+// buildkit is not supported by the daemon.
+func (o *Options) completeDockerClient(f factory.Factory) error {
+	var err error
 	o.dockerClient, err = f.DockerClient()
 	if err != nil {
 		return err
@@ -88,77 +257,313 @@ func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string)
 		_, _ = fmt.Fprintln(os.Stderr, "WARNING: buildkit is not supported by daemon")
 		o.disableBuildKit = true
 	}
-	defReg, registries, err := f.LoadRegistries()
-	if err != nil {
-		return err
-	}
-	if strings.IndexFunc(o.imageName, unicode.IsUpper) != -1 {
-		o.imageName = strings.ToLower(o.imageName)
-		_, _ = fmt.Fprintf(os.Stderr, "WARNING: uppercase char is not allowed in image name, changed to `%s`\n", o.imageName)
-	}
-	o.dstRegistry = registries[defReg]
-	o.allRegistries = registries
-	o.platform = f.Platform()
 	return nil
 }
 
 func (o *Options) Validate(args []string) error {
+	if len(o.builder) != 0 && o.disableBuildKit {
+		return fmt.Errorf("--builder cannot be used with --disable-buildkit")
+	}
+	for _, p := range o.platforms {
+		if !strings.ContainsRune(p, '/') {
+			return fmt.Errorf("invalid platform: %s, expected format: os/arch[/variant]", p)
+		}
+	}
+	if o.disableBuildKit && (len(o.secretFlags) != 0 || len(o.sshFlags) != 0) {
+		return fmt.Errorf("--secret and --ssh require buildkit")
+	}
+	if len(o.output) != 0 {
+		if o.disableBuildKit {
+			return fmt.Errorf("--output requires buildkit")
+		}
+		if len(o.platforms) > 1 {
+			return fmt.Errorf("--output cannot be used with multiple platforms")
+		}
+	}
+	if len(o.projectImages) != 0 && len(o.output) != 0 {
+		return fmt.Errorf("--output cannot be used with multiple images")
+	}
+	if o.explainContext && len(o.projectImages) != 0 {
+		return fmt.Errorf("--explain-context cannot be used with multiple images")
+	}
+	if len(o.compare) != 0 {
+		if o.noPush {
+			return fmt.Errorf("--compare requires pushing the image")
+		}
+		if len(o.projectImages) != 0 && o.compare != compareDeployed && strings.ContainsAny(o.compare, "/:@") {
+			return fmt.Errorf("--compare with multiple images must be a tag or %s", compareDeployed)
+		}
+		for _, tag := range append([]string{o.tagName}, o.extraTags...) {
+			if o.compare == tag {
+				// the tag is overwritten by the build before comparing
+				return fmt.Errorf("--compare cannot be a tag pushed by the build: %s", tag)
+			}
+		}
+	}
+	if len(o.format) != 0 && o.format != formatJSON {
+		return fmt.Errorf("unsupported output format: %s, expected json", o.format)
+	}
+	if o.parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	for _, tag := range o.extraTags {
+		if !imageutil.IsValidTag(tag) {
+			return fmt.Errorf("invalid tag: %s", tag)
+		}
+	}
 	return nil
 }
 
+// runCommand completes, validates and runs the build. The cloned or extracted context is removed
+// before returning, since CheckError exits without running deferred calls.
+func (o *Options) runCommand(f factory.Factory, cmd *cobra.Command, args []string) error {
+	defer o.cleanupContext()
+	if err := o.Complete(f, cmd, args); err != nil {
+		return err
+	}
+	if err := o.Validate(args); err != nil {
+		return err
+	}
+	return o.Run()
+}
+
 func (o *Options) Run() error {
-	if git.HasChanges() && !o.noConfirm {
+	o.stdout, o.out = os.Stdout, os.Stdout
+	if o.format == formatJSON {
+		// stdout is reserved for the result
+		o.out = os.Stderr
+		o.hooks.SetStdout(os.Stderr)
+	}
+	if o.explainContext {
+		return o.printContextUsage()
+	}
+	if o.hasChanges() && !o.noConfirm {
 		input := strings.ToLower(utils.Prompt("当前有未提交的改动, 是否继续构建? (Y/n) "))
 		if input == "n" {
 			return nil
 		}
 	}
 
-	var (
-		tag string
-		err error
-	)
-	if len(o.tagName) != 0 {
-		tag = o.tagName
-	} else {
-		currentHash, err := git.GetAbbrevCommitHash()
+	ctx := context.TODO()
+	start := time.Now()
+	if len(o.projectImages) != 0 {
+		err := o.runProjectImages(ctx)
 		if err != nil {
-			fmt.Println("WARNING: cannot get current commit, use `latest` as tag.")
-			tag = "latest"
-		} else {
-			tag, err = git.GetTagOfCommit(currentHash)
-			if err != nil {
-				branch, err := git.GetCurrentBranch()
-				if err != nil {
-					return err
-				}
-				tag = fmt.Sprintf("%s-%s", branch, currentHash)
-				tag = strings.ToLower(strings.ReplaceAll(tag, "/", "-"))
-			}
+			o.notifyFailure(o.projectImages, start, err)
+		}
+		return err
+	}
+	result, err := o.buildImage(ctx)
+	if err != nil {
+		o.notifyFailure([]string{o.imageName}, start, err)
+		return err
+	}
+	if err := o.writeMetadata(o.metadata(result)); err != nil {
+		return err
+	}
+	if len(result.existing) != 0 {
+		fmt.Fprintln(o.out, "镜像已存在, 跳过构建:")
+		for _, ref := range result.existing {
+			fmt.Fprintln(o.out, ref)
+		}
+		o.copyToClipboard(result.images[0])
+		return nil
+	}
+	if o.noPush {
+		if len(o.output) != 0 {
+			utils.FprintInfo(o.out, fmt.Sprintf("构建结果已导出到 %s", o.outputs[0].Attrs["dest"]))
 		}
+		return result.hookErr
 	}
 
-	ctx := context.TODO()
+	fmt.Fprintln(o.out, "镜像上传成功:")
+	for _, image := range result.allImages {
+		fmt.Fprintln(o.out, image)
+	}
+	o.copyToClipboard(result.images[0])
+	_ = notifyUser(fmt.Sprintf("%s:%s", o.imageName, result.tag), "镜像构建并上传成功")
+	ev := notify.NewEvent(notify.BuildSuccess, result.allImages...)
+	ev.Duration = result.duration
+	o.notifier.Notify(ev)
+	return result.hookErr
+}
+
+// notifyFailure sends build.failure of images to webhooks in config.
+func (o *Options) notifyFailure(images []string, start time.Time, err error) {
+	ev := notify.NewEvent(notify.BuildFailure, images...)
+	ev.Duration = time.Since(start)
+	ev.Err = err
+	o.notifier.Notify(ev)
+}
+
+// buildResult holds images built by buildImage.
+type buildResult struct {
+	tag string
+	// images[i] is the image with the computed tag in o.dstRegistries[i]
+	images []string
+	// allImages includes images with extra tags
+	allImages []string
+	// existing are references with digests of images found by --skip-existing, nothing is
+	// built if it is not empty
+	existing []string
+	stats    *buildStats
+	duration time.Duration
+	// hookErr is the failure of post-build or post-push hooks
+	hookErr error
+}
+
+// computeTag returns --tag-name if set, or else the tag rendered from the tag template.
+func (o *Options) computeTag() (string, error) {
+	if len(o.tagName) != 0 {
+		return o.tagName, nil
+	}
+	tmpl := o.tagTemplate
+	if len(tmpl) == 0 {
+		tmpl = o.config.TagTemplateOf(o.imageName)
+	}
+	return imagetag.Compute(tmpl)
+}
+
+// buildImage builds the image and pushes it to target registries unless --no-push is set.
+func (o *Options) buildImage(ctx context.Context) (*buildResult, error) {
+	start := time.Now()
+	tag, err := o.computeTag()
+	if err != nil {
+		return nil, err
+	}
+	budget, err := o.config.SizeBudgetOf(o.imageName)
+	if err != nil {
+		return nil, err
+	}
+	if budget.IsSet() && !o.canCheckBudget() {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: size budget of %s is not checked, it requires the image in the docker daemon before pushing\n", o.imageName)
+		budget = config.SizeBudget{}
+	}
 
-	repoWithTag := fmt.Sprintf("%s:%s", o.imageName, tag)
-	image := fmt.Sprintf("%s/%s", o.dstRegistry.Prefix(), repoWithTag)
+	images := o.imagesWithTag(tag)
+	extraImages := make([][]string, len(o.extraTags))
+	allImages := append([]string(nil), images...)
+	for i, extraTag := range o.extraTags {
+		extraImages[i] = o.imagesWithTag(extraTag)
+		allImages = append(allImages, extraImages[i]...)
+	}
 
-	termFd, isTerm := term.GetFdInfo(os.Stdout)
+	if o.canSkipExisting() {
+		existing, err := o.findExisting(ctx, images)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			for i, reg := range o.dstRegistries {
+				extra := make([]string, len(extraImages))
+				for j := range extraImages {
+					extra[j] = extraImages[j][i]
+				}
+				if err := o.tagExisting(ctx, reg, images[i], extra); err != nil {
+					return nil, err
+				}
+			}
+			return &buildResult{tag: tag, images: images, allImages: allImages, existing: existing, duration: time.Since(start)}, nil
+		}
+	}
 
+	vars := hook.Vars{Images: allImages}
+	// failures of post hooks are returned with the result, since the image is built or pushed
+	var hookErr error
+	if err := o.hooks.Pre(hook.Build, vars); err != nil {
+		return nil, err
+	}
+	// buildkitd and multi-platform builds push images while building
+	pushWhileBuilding := o.bkClient != nil || len(o.platforms) > 1
+	if pushWhileBuilding && !o.noPush {
+		if err := o.hooks.Pre(hook.Push, vars); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.checkContextSize(); err != nil {
+		return nil, err
+	}
+	o.stats = newBuildStats()
 	buildOpts := types.ImageBuildOptions{
-		Tags:       []string{image},
+		Tags:       allImages,
 		Remove:     true,
 		Dockerfile: o.dockerFileName,
 		PullParent: o.pull,
 		NoCache:    o.noCache,
 		BuildArgs:  utils.ConvertKVStringsToMapWithNil(o.buildArgs),
-		Labels:     utils.ConvertKVStringsToMap(o.labels),
+		Labels:     o.imageLabels(tag, time.Now()),
 		Platform:   o.platform,
+		CacheFrom:  o.cacheFromRefs,
+		Target:     o.target,
+		Outputs:    o.outputs,
+	}
+	if o.inlineCache {
+		inline := "1"
+		buildOpts.BuildArgs["BUILDKIT_INLINE_CACHE"] = &inline
+		buildOpts.Tags = append(buildOpts.Tags, o.cacheToRefs...)
+	}
+
+	switch {
+	case o.bkClient != nil:
+		// buildkitd builds all platforms into a manifest list and pushes all tags by itself
+		if len(o.platforms) > 1 {
+			buildOpts.Platform = strings.Join(o.platforms, ",")
+		}
+		err = o.build(ctx, buildOpts)
+	case len(o.platforms) > 1:
+		err = o.runMultiPlatform(ctx, buildOpts, images, extraImages, budget)
+	default:
+		err = o.build(ctx, buildOpts)
+		if err == nil {
+			err = o.checkBudget(ctx, images[0], "", budget)
+		}
+		if err == nil {
+			hookErr = o.hooks.Post(hook.Build, vars)
+		}
+		if err == nil && !o.noPush {
+			err = o.hooks.Pre(hook.Push, vars)
+		}
+		if err == nil && !o.noPush {
+			err = o.pushAll(ctx, images)
+		}
+		for _, extra := range extraImages {
+			if err == nil && !o.noPush {
+				err = o.pushAll(ctx, extra)
+			}
+		}
+		if err == nil && !o.noPush {
+			err = o.pushCache(ctx)
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
+	o.reportImageSize(ctx, images[0])
+	if pushWhileBuilding {
+		hookErr = o.hooks.Post(hook.Build, vars)
+	}
+	if !o.noPush && hookErr == nil {
+		vars.Digest = o.stats.digestOf(images[0])
+		hookErr = o.hooks.Post(hook.Push, vars)
+	}
+	return &buildResult{
+		tag:       tag,
+		images:    images,
+		allImages: allImages,
+		stats:     o.stats,
+		duration:  time.Since(start),
+		hookErr:   hookErr,
+	}, nil
+}
 
-	if o.disableBuildKit {
+func (o *Options) build(ctx context.Context, buildOpts types.ImageBuildOptions) error {
+	var err error
+	switch {
+	case o.bkClient != nil:
+		err = o.runBuildKitd(ctx, buildOpts)
+	case o.disableBuildKit:
 		err = o.runWithoutBuildKit(ctx, buildOpts)
-	} else {
+	default:
 		err = o.runBuildKit(ctx, buildOpts)
 	}
 
@@ -166,18 +571,53 @@ func (o *Options) Run() error {
 		_ = notifyUser(" ", "镜像构建失败")
 		return err
 	}
-	utils.PrintInfo("镜像构建成功")
+	utils.FprintInfo(o.out, "镜像构建成功")
+	return nil
+}
 
-	if o.noPush {
-		return nil
+// dockerfileOptions returns options to resolve base images in the Dockerfile.
+func (o *Options) dockerfileOptions() dockerfile.Options {
+	return dockerfile.Options{
+		BuildArgs:      buildArgValues(utils.ConvertKVStringsToMapWithNil(o.buildArgs)),
+		TargetPlatform: o.platform,
+	}
+}
+
+// imagesWithTag returns the image with tag in each target registry.
+func (o *Options) imagesWithTag(tag string) []string {
+	images := make([]string, len(o.dstRegistries))
+	for i, reg := range o.dstRegistries {
+		images[i] = fmt.Sprintf("%s/%s:%s", reg.Prefix(), o.imageName, tag)
+	}
+	return images
+}
+
+// pushAll pushes images[i] to o.dstRegistries[i] in parallel.
+func (o *Options) pushAll(ctx context.Context, images []string) error {
+	if len(images) == 1 {
+		return o.push(ctx, o.dstRegistries[0], images[0], true)
+	}
+	eg, ctx := errgroup.WithContext(ctx)
+	for i := range images {
+		reg, image := o.dstRegistries[i], images[i]
+		eg.Go(func() error {
+			// progress bars of parallel pushes would overwrite each other
+			if err := o.push(ctx, reg, image, false); err != nil {
+				return fmt.Errorf("push %s: %s", image, err)
+			}
+			return nil
+		})
 	}
+	return eg.Wait()
+}
 
-	err = o.dstRegistry.CreateRepoIfNotExists(o.imageName)
+func (o *Options) push(ctx context.Context, reg *registry.Registry, image string, tty bool) error {
+	err := reg.CreateRepoIfNotExists(imageutil.FromString(image).Repo)
 	if err != nil {
 		return err
 	}
 
-	authToken, err := o.dstRegistry.GetAuthToken()
+	authToken, err := reg.GetAuthToken()
 	if err != nil {
 		return err
 	}
@@ -188,19 +628,20 @@ func (o *Options) Run() error {
 		return err
 	}
 
-	utils.PrintInfo("开始上传镜像")
+	utils.FprintInfo(o.out, fmt.Sprintf("开始上传镜像 %s", image))
 	defer pushResp.Close()
-	err = jsonmessage.DisplayJSONMessagesStream(pushResp, os.Stdout, termFd, isTerm, nil)
+	stream := io.TeeReader(pushResp, progress.NewMessageWriter(func(msg jsonmessage.JSONMessage) {
+		o.stats.observePushMessage(image, msg)
+	}))
+	mode := o.progress
+	if !tty && mode != progress.JSON {
+		mode = progress.Plain
+	}
+	err = progress.DisplayJSONMessages(stream, mode, o.out, o.timings, nil)
 	if err != nil {
 		_ = notifyUser(" ", "镜像上传失败")
 		return err
 	}
-
-	fmt.Println("镜像上传成功:")
-	fmt.Println(image)
-	_ = utils.SetClipboard(image)
-	utils.PrintInfo("镜像地址已复制到粘贴板")
-	_ = notifyUser(repoWithTag, "镜像构建并上传成功")
 	return nil
 }
 
@@ -211,9 +652,9 @@ func (o *Options) runWithoutBuildKit(ctx context.Context, buildOpts types.ImageB
 		return err
 	}
 	defer dkfile.Close()
-	baseImages, err := utils.ExtractBaseImages(dkfile)
+	baseImages, err := dockerfile.BaseImages(dkfile, o.dockerfileOptions())
 	if err != nil {
-		return err
+		return fmt.Errorf("parse %s: %s", o.dockerFileName, err)
 	}
 	mem := make(map[string]struct{}, len(o.allRegistries))
 	for _, baseImage := range baseImages {
@@ -221,7 +662,7 @@ func (o *Options) runWithoutBuildKit(ctx context.Context, buildOpts types.ImageB
 			if _, ok := mem[name]; ok {
 				continue
 			}
-			if reg.MatchImage(baseImage) {
+			if reg.MatchImage(baseImage.Ref) {
 				authCfg, err := reg.GetAuthConfig()
 				if err != nil {
 					return fmt.Errorf("get authconfig of %s: %s", name, err)
@@ -233,7 +674,7 @@ func (o *Options) runWithoutBuildKit(ctx context.Context, buildOpts types.ImageB
 	}
 	buildOpts.AuthConfigs = authConfigs
 
-	ignores, err := utils.ReadDockerIgnore(o.context)
+	ignores, _, err := o.contextIgnores()
 	if err != nil {
 		return err
 	}
@@ -243,29 +684,53 @@ func (o *Options) runWithoutBuildKit(ctx context.Context, buildOpts types.ImageB
 	if err != nil {
 		return fmt.Errorf("tar: %s", err)
 	}
+	// the Dockerfile is looked up in the context sent to the daemon
+	if filepath.IsAbs(o.dockerFileName) {
+		rel, err := filepath.Rel(o.context, o.dockerFileName)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			buildOpts.Dockerfile = rel
+		} else {
+			buildOpts.Dockerfile, tarStream, err = addDockerfileToContext(o.dockerFileName, tarStream)
+			if err != nil {
+				return err
+			}
+		}
+	}
 	defer tarStream.Close()
 
 	resp, err := o.dockerClient.ImageBuild(ctx, tarStream, buildOpts)
 	if err != nil {
 		return err
 	}
-	utils.PrintInfo("开始构建镜像")
+	utils.FprintInfo(o.out, "开始构建镜像")
 	defer resp.Body.Close()
 
-	termFd, isTerm := term.GetFdInfo(os.Stdout)
-	return jsonmessage.DisplayJSONMessagesStream(resp.Body, os.Stdout, termFd, isTerm, nil)
+	stream := io.TeeReader(resp.Body, progress.NewMessageWriter(o.stats.observeBuildMessage))
+	return progress.DisplayJSONMessages(stream, o.progress, o.out, o.timings, nil)
 }
 
 func NewCmdBuild(f factory.Factory) *cobra.Command {
 	o := NewBuildOptions()
 	cmd := &cobra.Command{
-		Use:     "build [PATH]",
+		Use:     "build [PATH | URL | - | --all | NAME...]",
 		Aliases: []string{"b"},
 		Short:   "Build docker image",
+		Long: `Build docker image and push it to target registries.
+
+The context is the current directory, or PATH which may be a directory or a tarball like
+ctx.tar.gz, - for a tar read from stdin, or a git URL like git@github.com:foo/bar.git#ref:subdir
+or https://github.com/foo/bar.git#ref. Git contexts are cloned and tags are computed from the
+checked out ref. The Dockerfile defaults to the one in the context.
+
+The tag is --tag-name if set, or else rendered from --tag-template or tag-template in config.
+Without a template the tag is the git tag of HEAD, or else <branch>-<short sha>.
+
+If images are declared in .jki/project.yaml, --all or names of images build them in dependency
+order worked out from FROM lines. Base images in the project are replaced by freshly built ones.
+
+` + imagetag.TemplateHelp,
 		Run: func(cmd *cobra.Command, args []string) {
-			utils.CheckError(o.Complete(f, cmd, args))
-			utils.CheckError(o.Validate(args))
-			utils.CheckError(o.Run())
+			utils.CheckError(o.runCommand(f, cmd, args))
 		},
 	}
 
@@ -280,12 +745,53 @@ func NewCmdBuild(f factory.Factory) *cobra.Command {
 	flags.StringVarP(&o.dockerFileName, "file", "f", "Dockerfile", "Name of the Dockerfile")
 	flags.StringVar(&o.imageName, "image-name", path.Base(wd), "Custom image name")
 	flags.StringVarP(&o.tagName, "tag-name", "t", "", "Custom tag name")
+	flags.StringVar(&o.tagTemplate, "tag-template", "", "Template of the computed tag, overrides tag-template in config")
+	flags.StringArrayVar(&o.extraTags, "tag", nil, "Extra tag of the image besides the computed one, e.g. latest. Can be repeated")
+	flags.StringVar(&o.target, "target", "", "Set the target build stage to build")
+	flags.StringVar(&o.output, "output", "", "Export build results instead of pushing an image, type=local,dest=<dir> or type=tar,dest=<file>")
 	flags.BoolVar(&o.disableBuildKit, "disable-buildkit", false, "Disable buildkit")
+	flags.StringVar(&o.builder, "builder", "", "Build with a standalone buildkitd instead of the docker daemon, buildkit://<host>:<port> or unix://<socket>")
 	flags.BoolVarP(&o.noConfirm, "no-confirm", "y", false, "Answer yes for all questions")
 	flags.BoolVar(&o.noPush, "no-push", false, "Do not push built image")
+	flags.BoolVar(&o.explainContext, "explain-context", false, "Print the size and the largest directories and files of the context after applying dockerignore patterns instead of building")
+	flags.StringVar(&o.compare, "compare", "", "Compare the size of the built image with a tag of the image, an image reference, or deployed for the image of the first deploy target")
+	flags.StringVar(&o.metadataFile, "metadata-file", "", "Write the build result in JSON to the file")
+	flags.StringVarP(&o.format, "output-format", "o", "", "Print the build result in the format instead of text, json")
+	flags.BoolVar(&o.skipExisting, "skip-existing", false, "Skip building if the tree is clean and the tag already exists in all target registries")
 	flags.BoolVar(&o.noCache, "no-cache", false, "Do not use cache when building the image")
 	flags.BoolVar(&o.pull, "pull", false, "Always attempt to pull a newer version of the image")
 	flags.StringSliceVar(&o.buildArgs, "build-arg", nil, "Set build-time variables")
 	flags.StringSliceVar(&o.labels, "label", nil, "Set metadata for an image")
+	flags.BoolVar(&o.noProvenance, "no-provenance", false, "Do not add org.opencontainers.image.* labels of the git revision")
+	flags.StringSliceVar(&o.cacheFrom, "cache-from", nil, "External cache sources, e.g. type=registry,ref=foo/bar:cache or an image. Use type=registry for the default cache repository")
+	flags.StringVar(&o.cacheTo, "cache-to", "", "Cache export destination, type=inline or type=registry[,ref=foo/bar:cache]")
+	flags.StringArrayVar(&o.secretFlags, "secret", nil, "Secret to expose to the build, e.g. id=npmrc,src=~/.npmrc or id=token,env=GITHUB_TOKEN")
+	flags.StringArrayVar(&o.sshFlags, "ssh", nil, "SSH agent socket or keys to expose to the build, default|<id>[=<socket>|<key>[,<key>]]")
+	flags.BoolVar(&o.all, "all", false, "Build all images declared in the project file")
+	flags.StringVar(&o.since, "since", "", "Skip project images whose paths are unchanged since the git ref")
+	flags.IntVar(&o.parallel, "parallel", 4, "Max number of project images built in parallel")
+	flags.StringSliceVar(&o.platforms, "platforms", nil, "Build for multiple platforms and push a multi-arch image, e.g. linux/amd64,linux/arm64. Images of each platform are pushed by digest without tags")
 	return cmd
 }
+
+// addDockerfileToContext adds the Dockerfile outside the context to the context tar stream
+// with a random name, which is returned.
+func addDockerfileToContext(dockerfile string, tarStream io.ReadCloser) (string, io.ReadCloser, error) {
+	data, err := ioutil.ReadFile(dockerfile)
+	if err != nil {
+		return "", nil, err
+	}
+	name := fmt.Sprintf(".dockerfile.%d", time.Now().UnixNano())
+	tarStream = archive.ReplaceFileTarWrapper(tarStream, map[string]archive.TarModifierFunc{
+		name: func(_ string, _ *tar.Header, _ io.Reader) (*tar.Header, []byte, error) {
+			header := &tar.Header{
+				Name:     name,
+				Mode:     0600,
+				ModTime:  time.Now(),
+				Typeflag: tar.TypeReg,
+			}
+			return header, data, nil
+		},
+	})
+	return name, tarStream, nil
+}
@@ -9,17 +9,18 @@ import (
 	"path"
 	"time"
 
-	"github.com/containerd/console"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/docker/docker/pkg/term"
 	controlapi "github.com/moby/buildkit/api/services/control"
 	bkclient "github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/filesync"
-	"github.com/moby/buildkit/util/progress/progressui"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
 	fsutiltypes "github.com/tonistiigi/fsutil/types"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/iftechio/jki/pkg/config"
+	"github.com/iftechio/jki/pkg/progress"
 )
 
 func writeSolveStatusToChannel(displayCh chan *bkclient.SolveStatus) func(jsonmessage.JSONMessage) {
@@ -90,29 +91,71 @@ func trySession(contextDir string) (*session.Session, error) {
 	return s, nil
 }
 
-func (o *Options) runBuildKit(ctx context.Context, buildOpts types.ImageBuildOptions) error {
-	s, err := trySession(o.context)
+// syncedDirs returns the provider of the context and the Dockerfile directory. The builder reads
+// .dockerignore of the context by itself, but not <Dockerfile>.dockerignore, so excludes are sent
+// along with the context.
+func (o *Options) syncedDirs() (session.Attachable, error) {
+	excludes, _, err := o.contextIgnores()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var dockerfileDir string
-	if len(o.dockerFileName) == 0 {
-		dockerfileDir = o.context
-	} else {
+	dockerfileDir := o.context
+	if len(o.dockerFileName) != 0 {
 		dockerfileDir = path.Dir(o.dockerFileName)
 	}
-	s.Allow(filesync.NewFSSyncProvider([]filesync.SyncedDir{
+	return filesync.NewFSSyncProvider([]filesync.SyncedDir{
 		{
-			Name: "context",
-			Dir:  o.context,
-			Map:  resetUIDAndGID,
+			Name:     "context",
+			Dir:      o.context,
+			Excludes: excludes,
+			Map:      resetUIDAndGID,
 		},
 		{
 			Name: "dockerfile",
 			Dir:  dockerfileDir,
 		},
-	}))
-	s.Allow(NewAuthProvider(o.allRegistries))
+	}), nil
+}
+
+// sessionAttachables returns providers of registry auth, secrets and SSH agents.
+func (o *Options) sessionAttachables() ([]session.Attachable, error) {
+	attachables := []session.Attachable{NewAuthProvider(o.allRegistries)}
+	secrets := append([]config.Secret(nil), o.config.Project(o.imageName).Secrets...)
+	secretAttachable, err := secretProvider(append(secrets, o.secrets...))
+	if err != nil {
+		return nil, err
+	}
+	attachables = append(attachables, secretAttachable)
+	if len(o.sshConfigs) != 0 {
+		agent, err := sshprovider.NewSSHAgentProvider(o.sshConfigs)
+		if err != nil {
+			return nil, fmt.Errorf("forward ssh agent: %s", err)
+		}
+		attachables = append(attachables, agent)
+	}
+	return attachables, nil
+}
+
+func (o *Options) runBuildKit(ctx context.Context, buildOpts types.ImageBuildOptions) error {
+	s, err := trySession(o.context)
+	if err != nil {
+		return err
+	}
+	fs, err := o.syncedDirs()
+	if err != nil {
+		return err
+	}
+	s.Allow(fs)
+	attachables, err := o.sessionAttachables()
+	if err != nil {
+		return err
+	}
+	for _, a := range attachables {
+		s.Allow(a)
+	}
+	for _, out := range buildOpts.Outputs {
+		s.Allow(outputProvider(out))
+	}
 
 	eg, ctx := errgroup.WithContext(ctx)
 	dialSession := func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
@@ -129,7 +172,6 @@ func (o *Options) runBuildKit(ctx context.Context, buildOpts types.ImageBuildOpt
 		buildOpts.SessionID = s.ID()
 		buildOpts.BuildID = time.Now().String()
 		buildOpts.Dockerfile = path.Base(o.dockerFileName)
-		buildOpts.Platform = o.platform
 
 		response, err := o.dockerClient.ImageBuild(ctx, nil, buildOpts)
 		if err != nil {
@@ -139,8 +181,9 @@ func (o *Options) runBuildKit(ctx context.Context, buildOpts types.ImageBuildOpt
 
 		done := make(chan struct{})
 		displayCh := make(chan *bkclient.SolveStatus)
+		statusCh := o.stats.tee(displayCh)
 		defer close(done)
-		defer close(displayCh)
+		defer close(statusCh)
 
 		eg.Go(func() error {
 			select {
@@ -151,18 +194,11 @@ func (o *Options) runBuildKit(ctx context.Context, buildOpts types.ImageBuildOpt
 			return nil
 		})
 
-		out := os.Stderr
-
-		var c console.Console
-		if cons, err := console.ConsoleFromFile(out); err == nil {
-			c = cons
-		}
 		eg.Go(func() error {
-			return progressui.DisplaySolveStatus(ctx, "", c, out, displayCh)
+			return progress.DisplaySolveStatus(ctx, o.progress, os.Stderr, o.timings, displayCh)
 		})
-		writeAux := writeSolveStatusToChannel(displayCh)
-		termFd, isTerm := term.GetFdInfo(os.Stdout)
-		return jsonmessage.DisplayJSONMessagesStream(response.Body, os.Stdout, termFd, isTerm, writeAux)
+		writeAux := writeSolveStatusToChannel(statusCh)
+		return progress.DisplayJSONMessages(response.Body, o.progress, o.out, nil, writeAux)
 	})
 
 	return eg.Wait()
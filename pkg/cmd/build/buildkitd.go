@@ -0,0 +1,160 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	bkclient "github.com/moby/buildkit/client"
+	"golang.org/x/sync/errgroup"
+
+	imageutil "github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/progress"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+// builderAddress converts --builder to the address of buildkitd.
+func builderAddress(builder string) (string, error) {
+	switch {
+	case strings.HasPrefix(builder, "buildkit://"):
+		return "tcp://" + strings.TrimPrefix(builder, "buildkit://"), nil
+	case strings.HasPrefix(builder, "tcp://"), strings.HasPrefix(builder, "unix://"):
+		return builder, nil
+	}
+	return "", fmt.Errorf("unsupported builder: %s, expected buildkit://<host>:<port> or unix://<socket>", builder)
+}
+
+// buildArgValues returns values of build args. Same as docker, the value of a build arg without
+// value is taken from environment, and it is unset if the variable is not set either.
+func buildArgValues(buildArgs map[string]*string) map[string]string {
+	values := make(map[string]string, len(buildArgs))
+	for k, v := range buildArgs {
+		if v != nil {
+			values[k] = *v
+		} else if env, ok := os.LookupEnv(k); ok {
+			values[k] = env
+		}
+	}
+	return values
+}
+
+// frontendAttrs converts buildOpts to attributes of the dockerfile frontend.
+func frontendAttrs(buildOpts types.ImageBuildOptions) map[string]string {
+	attrs := map[string]string{
+		"filename": path.Base(buildOpts.Dockerfile),
+	}
+	if len(buildOpts.Target) != 0 {
+		attrs["target"] = buildOpts.Target
+	}
+	if len(buildOpts.Platform) != 0 {
+		attrs["platform"] = buildOpts.Platform
+	}
+	if buildOpts.NoCache {
+		attrs["no-cache"] = ""
+	}
+	if buildOpts.PullParent {
+		attrs["image-resolve-mode"] = "pull"
+	}
+	for k, v := range buildArgValues(buildOpts.BuildArgs) {
+		attrs["build-arg:"+k] = v
+	}
+	for k, v := range buildOpts.Labels {
+		attrs["label:"+k] = v
+	}
+	return attrs
+}
+
+// exportEntry returns where the build result is exported. Images are pushed by buildkitd
+// directly since there is no local image store.
+func (o *Options) exportEntry(buildOpts types.ImageBuildOptions) (bkclient.ExportEntry, error) {
+	for _, out := range buildOpts.Outputs {
+		dest := out.Attrs["dest"]
+		if out.Type == outputTypeLocal {
+			return bkclient.ExportEntry{Type: bkclient.ExporterLocal, OutputDir: dest}, nil
+		}
+		return bkclient.ExportEntry{
+			Type: bkclient.ExporterTar,
+			Output: func(map[string]string) (io.WriteCloser, error) {
+				return os.Create(dest)
+			},
+		}, nil
+	}
+	if !o.noPush {
+		images := append([]string(nil), buildOpts.Tags...)
+		for _, cache := range o.cacheExports {
+			if ref, ok := cache.Attrs["ref"]; ok {
+				images = append(images, ref)
+			}
+		}
+		for _, image := range images {
+			reg, err := o.registryOf(image)
+			if err != nil {
+				return bkclient.ExportEntry{}, err
+			}
+			if err := reg.CreateRepoIfNotExists(imageutil.FromString(image).Repo); err != nil {
+				return bkclient.ExportEntry{}, err
+			}
+		}
+	}
+	return bkclient.ExportEntry{
+		Type: bkclient.ExporterImage,
+		Attrs: map[string]string{
+			"name": strings.Join(buildOpts.Tags, ","),
+			"push": strconv.FormatBool(!o.noPush),
+		},
+	}, nil
+}
+
+// runBuildKitd builds with the standalone buildkitd of --builder.
+func (o *Options) runBuildKitd(ctx context.Context, buildOpts types.ImageBuildOptions) error {
+	// LocalDirs cannot carry excludes, so the directories are synced by our own provider
+	fs, err := o.syncedDirs()
+	if err != nil {
+		return err
+	}
+	attachables, err := o.sessionAttachables()
+	if err != nil {
+		return err
+	}
+	export, err := o.exportEntry(buildOpts)
+	if err != nil {
+		return err
+	}
+	cacheImports := make([]bkclient.CacheOptionsEntry, len(buildOpts.CacheFrom))
+	for i, ref := range buildOpts.CacheFrom {
+		cacheImports[i] = bkclient.CacheOptionsEntry{Type: cacheTypeRegistry, Attrs: map[string]string{"ref": ref}}
+	}
+	solveOpt := bkclient.SolveOpt{
+		Exports:       []bkclient.ExportEntry{export},
+		Frontend:      "dockerfile.v0",
+		FrontendAttrs: frontendAttrs(buildOpts),
+		CacheExports:  o.cacheExports,
+		CacheImports:  cacheImports,
+		Session:       append(attachables, fs),
+	}
+
+	utils.FprintInfo(o.out, fmt.Sprintf("开始构建镜像 (%s)", o.builder))
+	ch := make(chan *bkclient.SolveStatus)
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		resp, err := o.bkClient.Solve(ctx, nil, solveOpt, o.stats.tee(ch))
+		if err != nil {
+			return err
+		}
+		if dgst, ok := resp.ExporterResponse["containerimage.digest"]; ok {
+			for _, image := range buildOpts.Tags {
+				o.stats.setDigest(image, dgst)
+			}
+		}
+		return nil
+	})
+	eg.Go(func() error {
+		return progress.DisplaySolveStatus(ctx, o.progress, os.Stderr, o.timings, ch)
+	})
+	return eg.Wait()
+}
@@ -0,0 +1,151 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	bkclient "github.com/moby/buildkit/client"
+
+	"github.com/iftechio/jki/pkg/registry"
+)
+
+const (
+	cacheTypeRegistry = "registry"
+	cacheTypeInline   = "inline"
+
+	defaultCacheRepo = "{image}-buildcache"
+	defaultCacheTag  = "latest"
+)
+
+// cacheOption is a parsed --cache-from/--cache-to value, e.g. `type=registry,ref=foo/bar:cache`.
+// A plain image reference is a shorthand of `type=registry,ref=<image>`.
+type cacheOption struct {
+	Type  string
+	Attrs map[string]string
+}
+
+func parseCacheOption(s string) (cacheOption, error) {
+	opt := cacheOption{Attrs: make(map[string]string)}
+	if !strings.ContainsRune(s, '=') {
+		opt.Type = cacheTypeRegistry
+		opt.Attrs["ref"] = s
+		return opt, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return opt, fmt.Errorf("invalid cache option: %s", s)
+		}
+		if kv[0] == "type" {
+			opt.Type = kv[1]
+		} else {
+			opt.Attrs[kv[0]] = kv[1]
+		}
+	}
+	switch opt.Type {
+	case cacheTypeRegistry, cacheTypeInline:
+	case "":
+		opt.Type = cacheTypeRegistry
+	default:
+		return opt, fmt.Errorf("unsupported cache type: %s", opt.Type)
+	}
+	return opt, nil
+}
+
+// defaultCacheRef returns the cache reference of the image in reg, which is
+// `<prefix>/<image>-buildcache:latest` unless `cache_repo` is set for the registry.
+func (o *Options) defaultCacheRef(reg *registry.Registry) string {
+	repo := reg.CacheRepo
+	if len(repo) == 0 {
+		repo = defaultCacheRepo
+	}
+	repo = strings.ReplaceAll(repo, "{image}", o.imageName)
+	return fmt.Sprintf("%s/%s:%s", reg.Prefix(), repo, defaultCacheTag)
+}
+
+// cacheRefs returns refs of opt. Default cache references of all target registries are
+// returned if no ref is given.
+func (o *Options) cacheRefs(opt cacheOption) []string {
+	if ref, ok := opt.Attrs["ref"]; ok {
+		return []string{ref}
+	}
+	refs := make([]string, len(o.dstRegistries))
+	for i, reg := range o.dstRegistries {
+		refs[i] = o.defaultCacheRef(reg)
+	}
+	return refs
+}
+
+// completeCacheOptions resolves --cache-from and --cache-to into images to import cache from,
+// images to push with inline cache, and whether inline cache metadata should be embedded.
+func (o *Options) completeCacheOptions() error {
+	for _, s := range o.cacheFrom {
+		opt, err := parseCacheOption(s)
+		if err != nil {
+			return err
+		}
+		if opt.Type != cacheTypeRegistry {
+			return fmt.Errorf("unsupported cache type for --cache-from: %s", opt.Type)
+		}
+		o.cacheFromRefs = append(o.cacheFromRefs, o.cacheRefs(opt)...)
+	}
+	if len(o.cacheTo) == 0 {
+		return nil
+	}
+	opt, err := parseCacheOption(o.cacheTo)
+	if err != nil {
+		return err
+	}
+	if len(o.builder) != 0 {
+		// buildkitd exports cache by itself, including all intermediate layers with mode=max
+		o.cacheExports = nil
+		if opt.Type == cacheTypeInline {
+			o.cacheExports = append(o.cacheExports, bkclient.CacheOptionsEntry{Type: cacheTypeInline})
+			return nil
+		}
+		for _, ref := range o.cacheRefs(opt) {
+			attrs := map[string]string{"ref": ref}
+			if mode, ok := opt.Attrs["mode"]; ok {
+				attrs["mode"] = mode
+			}
+			o.cacheExports = append(o.cacheExports, bkclient.CacheOptionsEntry{Type: cacheTypeRegistry, Attrs: attrs})
+		}
+		return nil
+	}
+	o.inlineCache = true
+	if opt.Type == cacheTypeRegistry {
+		if opt.Attrs["mode"] == "max" {
+			_, _ = fmt.Fprintln(os.Stderr, "WARNING: mode=max is not supported by docker daemon, only layers of the final stage are cached")
+		}
+		// docker daemon cannot export cache to registries, so the image is pushed to the cache
+		// reference with inline cache metadata instead.
+		o.cacheToRefs = o.cacheRefs(opt)
+	}
+	return nil
+}
+
+// pushCache pushes the image with inline cache metadata to cache references.
+func (o *Options) pushCache(ctx context.Context) error {
+	for _, ref := range o.cacheToRefs {
+		reg, err := o.registryOf(ref)
+		if err != nil {
+			return err
+		}
+		if err := o.push(ctx, reg, ref, true); err != nil {
+			return fmt.Errorf("push cache %s: %s", ref, err)
+		}
+	}
+	return nil
+}
+
+// registryOf returns the configured registry of image.
+func (o *Options) registryOf(image string) (*registry.Registry, error) {
+	for _, reg := range o.allRegistries {
+		if reg.MatchImage(image) {
+			return reg, nil
+		}
+	}
+	return nil, fmt.Errorf("registry of %s is not found in config", image)
+}
@@ -0,0 +1,271 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/docker/pkg/symlink"
+	"github.com/docker/docker/pkg/urlutil"
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/iftechio/jki/pkg/git"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+// stdinContext is the context argument to read a tar from stdin.
+const stdinContext = "-"
+
+var tarballSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tar.xz", ".txz"}
+
+// isGitContext reports whether s is a git URL like git@github.com:foo/bar.git#ref:subdir or
+// https://github.com/foo/bar.git#ref.
+func isGitContext(s string) bool {
+	return urlutil.IsGitURL(s) || strings.HasPrefix(s, "ssh://")
+}
+
+func isTarball(s string) bool {
+	for _, suffix := range tarballSuffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGitContext splits a git URL into the remote, the ref and the subdirectory given by the
+// fragment `#ref:subdir`.
+func parseGitContext(s string) (remote, ref, subdir string, err error) {
+	remote = s
+	if i := strings.IndexRune(s, '#'); i != -1 {
+		remote = s[:i]
+		fragment := strings.SplitN(s[i+1:], ":", 2)
+		ref = fragment[0]
+		if len(fragment) == 2 {
+			subdir = fragment[1]
+		}
+	}
+	if strings.HasPrefix(remote, "github.com/") {
+		remote = "https://" + remote
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", "", "", fmt.Errorf("invalid ref: %s", ref)
+	}
+	return remote, ref, subdir, nil
+}
+
+// repoName returns the name of the repository of a git remote, e.g. bar for
+// git@github.com:foo/bar.git.
+func repoName(remote string) string {
+	remote = strings.TrimSuffix(strings.TrimSuffix(remote, "/"), ".git")
+	if i := strings.LastIndexAny(remote, "/:"); i != -1 {
+		remote = remote[i+1:]
+	}
+	return remote
+}
+
+// cloneContext clones the git context s into a temporary directory and returns the directory and
+// the context in it.
+func cloneContext(s string) (dir, context string, err error) {
+	remote, ref, subdir, err := parseGitContext(s)
+	if err != nil {
+		return "", "", err
+	}
+	dir, err = ioutil.TempDir("", "jki-build-git-")
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "Cloning %s\n", git.StripCredentials(remote))
+	if err := git.Clone(remote, ref, dir); err != nil {
+		return "", "", err
+	}
+	context = dir
+	if len(subdir) != 0 {
+		context, err = symlink.FollowSymlinkInScope(filepath.Join(dir, subdir), dir)
+		if err != nil {
+			return "", "", fmt.Errorf("%s is not within the repository: %s", subdir, err)
+		}
+		fi, err := os.Stat(context)
+		if err != nil {
+			return "", "", err
+		}
+		if !fi.IsDir() {
+			return "", "", fmt.Errorf("%s is not a directory", subdir)
+		}
+	}
+	return dir, context, nil
+}
+
+// extractContext extracts the tar read from r, which may be compressed, into a temporary
+// directory.
+func extractContext(r io.Reader) (dir string, err error) {
+	dir, err = ioutil.TempDir("", "jki-build-tar-")
+	if err != nil {
+		return "", err
+	}
+	if err := archive.Untar(r, dir, &archive.TarOptions{NoLchown: true}); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("extract context: %s", err)
+	}
+	return dir, nil
+}
+
+// completeContext sets the context from args if it is a git URL, a tarball, `-` or a directory,
+// and reports whether it is. Git contexts are cloned and become the working directory, so tags
+// and provenance labels are computed from the remote ref. Tarballs are extracted. The Dockerfile
+// defaults to the one in the context, and --file is relative to the context unless it is a local
+// directory.
+func (o *Options) completeContext(cmd *cobra.Command, args []string) (bool, error) {
+	if len(args) != 1 {
+		return false, nil
+	}
+	arg := args[0]
+	flags := cmd.Flags()
+	name := ""
+	local := false
+	switch {
+	case isGitContext(arg):
+		dir, context, err := cloneContext(arg)
+		if err != nil {
+			return false, err
+		}
+		o.tmpContext, o.context = dir, context
+		if err := os.Chdir(context); err != nil {
+			return false, err
+		}
+		name = path.Base(context)
+		if context == dir {
+			remote, _, _, _ := parseGitContext(arg)
+			name = repoName(remote)
+		}
+	case arg == stdinContext:
+		dir, err := extractContext(os.Stdin)
+		if err != nil {
+			return false, err
+		}
+		o.tmpContext, o.context, o.archived = dir, dir, true
+	case isTarball(arg):
+		f, err := os.Open(arg)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		dir, err := extractContext(f)
+		if err != nil {
+			return false, err
+		}
+		o.tmpContext, o.context, o.archived = dir, dir, true
+	default:
+		fi, err := os.Stat(arg)
+		if err != nil || !fi.IsDir() {
+			// names of images in the project
+			return false, nil
+		}
+		o.context, err = filepath.Abs(arg)
+		if err != nil {
+			return false, fmt.Errorf("failed to resolve absolute path: %s", err)
+		}
+		name = filepath.Base(o.context)
+		local = true
+	}
+
+	if len(name) != 0 && !flags.Changed("image-name") {
+		o.imageName = name
+	}
+	switch {
+	case !flags.Changed("file"):
+		o.dockerFileName = filepath.Join(o.context, "Dockerfile")
+	case !local && !filepath.IsAbs(o.dockerFileName):
+		o.dockerFileName = filepath.Join(o.context, o.dockerFileName)
+	}
+	return true, nil
+}
+
+// hasChanges reports whether the context has uncommitted changes. Extracted contexts are not in
+// the git repository of the working directory, so they have none.
+func (o *Options) hasChanges() bool {
+	return !o.archived && git.HasChanges()
+}
+
+// cleanupContext removes the context cloned or extracted by completeContext.
+func (o *Options) cleanupContext() {
+	if len(o.tmpContext) != 0 {
+		os.RemoveAll(o.tmpContext)
+	}
+}
+
+// contextTop is the number of largest directories and files printed by --explain-context.
+const contextTop = 20
+
+// contextIgnores returns dockerignore patterns of the context and the ignore file read, which is
+// `<Dockerfile>.dockerignore` if it exists, or else .dockerignore in the context.
+func (o *Options) contextIgnores() ([]string, string, error) {
+	if len(o.ignoreFor) != 0 {
+		return utils.ReadDockerIgnoreFor(o.context, o.ignoreFor)
+	}
+	return utils.ReadDockerIgnoreFor(o.context, o.dockerFileName)
+}
+
+// printContextUsage prints the size of the context and its largest directories and files.
+func (o *Options) printContextUsage() error {
+	excludes, ignoreFile, err := o.contextIgnores()
+	if err != nil {
+		return err
+	}
+	usage, err := utils.MeasureContext(o.context, excludes, contextTop)
+	if err != nil {
+		return err
+	}
+	if len(ignoreFile) == 0 {
+		ignoreFile = "none"
+	}
+	fmt.Fprintf(o.out, "Context: %s\nIgnore file: %s\nTotal: %s in %d files\n", o.context, ignoreFile, units.HumanSize(float64(usage.Size)), usage.Files)
+	for _, section := range []struct {
+		title string
+		sizes []utils.PathSize
+	}{
+		{"Largest directories", usage.Dirs},
+		{"Largest files", usage.LargestFiles},
+	} {
+		if len(section.sizes) == 0 {
+			continue
+		}
+		fmt.Fprintf(o.out, "\n%s:\n", section.title)
+		for _, ps := range section.sizes {
+			fmt.Fprintf(o.out, "%10s  %s\n", units.HumanSize(float64(ps.Size)), ps.Path)
+		}
+	}
+	return nil
+}
+
+// checkContextSize warns if the context is larger than context-size-warning in config.
+func (o *Options) checkContextSize() error {
+	limit, err := o.config.ContextSizeLimit()
+	if err != nil || limit <= 0 {
+		return err
+	}
+	excludes, _, err := o.contextIgnores()
+	if err != nil {
+		return err
+	}
+	usage, err := utils.MeasureContext(o.context, excludes, 0)
+	if err != nil {
+		return err
+	}
+	if usage.Size > limit {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: build context %s is %s in %d files, larger than %s. Run `jki build --explain-context` to find files to add to .dockerignore\n",
+			o.context, units.HumanSize(float64(usage.Size)), usage.Files, units.HumanSize(float64(limit)))
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/iftechio/jki/pkg/git"
+	imageutil "github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+// canSkipExisting reports whether --skip-existing applies. Images of a dirty tree never match
+// the commit they are tagged with, so they are always rebuilt, and so are images of extracted
+// contexts which have no commit. Existing images are checked by findExisting to be built from HEAD.
+func (o *Options) canSkipExisting() bool {
+	return o.skipExisting && !o.noPush && len(o.outputs) == 0 && !o.archived && !git.HasChanges()
+}
+
+// tagHasCommit reports whether the computed tag is specific to the commit, which is the case for
+// the default tag and templates with the commit hash. Tags like latest or {branch} are pushed
+// again by later commits.
+func (o *Options) tagHasCommit() bool {
+	if len(o.tagName) != 0 {
+		return false
+	}
+	tmpl := o.tagTemplate
+	if len(tmpl) == 0 {
+		tmpl = o.config.TagTemplateOf(o.imageName)
+	}
+	return len(tmpl) == 0 || strings.Contains(tmpl, "{sha}") || strings.Contains(tmpl, "{short_sha}")
+}
+
+// builtFromHead reports whether the existing image was built from the commit of HEAD, according
+// to its revision label. Without the label, the image is assumed to be built from HEAD only if
+// the tag is specific to the commit.
+func (o *Options) builtFromHead(ctx context.Context, reg *registry.Registry, image string) (bool, error) {
+	head, err := git.GetCommitHash()
+	if err != nil {
+		return false, nil
+	}
+	img := imageutil.FromString(image)
+	client := reg.NewClient()
+	m, err := client.ResolveManifest(ctx, img.Path(), img.Tag, imageutil.ParsePlatform(o.platform))
+	if err != nil {
+		return false, fmt.Errorf("resolve %s: %s", image, err)
+	}
+	config, err := client.GetConfig(ctx, img.Path(), &m.Manifest)
+	if err != nil {
+		return false, fmt.Errorf("get config of %s: %s", image, err)
+	}
+	revision, ok := config.Config.Labels[labelRevision]
+	if !ok {
+		return o.tagHasCommit(), nil
+	}
+	return revision == head, nil
+}
+
+// findExisting looks up images[i] in o.dstRegistries[i] through the registry API, and returns
+// references with digests if all of them exist and are built from HEAD, or nil otherwise.
+func (o *Options) findExisting(ctx context.Context, images []string) ([]string, error) {
+	refs := make([]string, len(images))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i := range images {
+		i := i
+		eg.Go(func() error {
+			img := imageutil.FromString(images[i])
+			desc, err := o.dstRegistries[i].NewClient().HeadManifest(ctx, img.Path(), img.Tag)
+			if err == registry.ErrNotFound {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("check %s: %s", images[i], err)
+			}
+			refs[i] = fmt.Sprintf("%s@%s", images[i], desc.Digest)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if len(ref) == 0 {
+			return nil, nil
+		}
+	}
+	ok, err := o.builtFromHead(ctx, o.dstRegistries[0], images[0])
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		_, _ = fmt.Fprintf(os.Stderr, "%s exists but is not built from the current commit, rebuilding\n", images[0])
+		return nil, nil
+	}
+	return refs, nil
+}
+
+// tagExisting points extra tags to the existing manifest of image in reg without pulling it.
+func (o *Options) tagExisting(ctx context.Context, reg *registry.Registry, image string, extraImages []string) error {
+	client := reg.NewClient()
+	img := imageutil.FromString(image)
+	data, desc, err := client.GetManifest(ctx, img.Path(), img.Tag)
+	if err != nil {
+		return fmt.Errorf("get manifest of %s: %s", image, err)
+	}
+	for _, extra := range extraImages {
+		ex := imageutil.FromString(extra)
+		if _, err := client.PutManifest(ctx, ex.Path(), ex.Tag, desc.MediaType, data); err != nil {
+			return err
+		}
+		utils.FprintInfo(o.out, fmt.Sprintf("%s -> %s", extra, desc.Digest))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/pkg/term"
+
+	"github.com/iftechio/jki/pkg/git"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+const formatJSON = "json"
+
+// hasTTY reports whether jki is run in a terminal. Clipboard and desktop notifications are
+// skipped otherwise, e.g. in CI.
+var hasTTY = term.IsTerminal(os.Stdout.Fd())
+
+// TagInputs are inputs of the computed tag.
+type TagInputs struct {
+	TagName  string `json:"tag_name,omitempty"`
+	Template string `json:"template,omitempty"`
+	Branch   string `json:"branch,omitempty"`
+	Commit   string `json:"commit,omitempty"`
+	GitTag   string `json:"git_tag,omitempty"`
+	Dirty    bool   `json:"dirty"`
+}
+
+// CacheMetadata counts build steps served from cache.
+type CacheMetadata struct {
+	Steps  int     `json:"steps"`
+	Cached int     `json:"cached"`
+	Ratio  float64 `json:"ratio"`
+}
+
+// Metadata is the result of building an image, written by --metadata-file and --output-format json.
+type Metadata struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+	// Images are references of the image in target registries, including extra tags.
+	Images []string `json:"images"`
+	// Digest is the digest of the image, or the manifest list of multiple platforms.
+	Digest    string    `json:"digest,omitempty"`
+	Platforms []string  `json:"platforms,omitempty"`
+	TagInputs TagInputs `json:"tag_inputs"`
+	Pushed    bool      `json:"pushed"`
+	// Existing is set if the build is skipped by --skip-existing.
+	Existing bool          `json:"existing"`
+	Duration float64       `json:"duration_seconds"`
+	Cache    CacheMetadata `json:"cache"`
+	// PushSize is the total size in bytes of layers pushed, not including those already in the
+	// registries.
+	PushSize int64 `json:"push_size"`
+}
+
+// ProjectMetadata is the result of building images of a project.
+type ProjectMetadata struct {
+	Images []Metadata `json:"images"`
+	// Skipped are names of images unchanged since --since.
+	Skipped []string `json:"skipped"`
+}
+
+// tagInputs returns inputs of the tag computed by computeTag.
+func (o *Options) tagInputs() TagInputs {
+	inputs := TagInputs{TagName: o.tagName, Template: o.tagTemplate}
+	if len(inputs.Template) == 0 && o.config != nil {
+		inputs.Template = o.config.TagTemplateOf(o.imageName)
+	}
+	if o.archived {
+		return inputs
+	}
+	inputs.Branch, _ = git.GetCurrentBranch()
+	inputs.Commit, _ = git.GetCommitHash()
+	if len(inputs.Commit) != 0 {
+		inputs.GitTag, _ = git.GetTagOfCommit(inputs.Commit)
+		inputs.Dirty = git.HasChanges()
+	}
+	return inputs
+}
+
+// metadata returns the metadata of result.
+func (o *Options) metadata(result *buildResult) Metadata {
+	m := Metadata{
+		Name:      o.imageName,
+		Tag:       result.tag,
+		Images:    result.allImages,
+		Platforms: o.platforms,
+		TagInputs: o.tagInputs(),
+		Pushed:    !o.noPush && len(result.existing) == 0,
+		Existing:  len(result.existing) != 0,
+		Duration:  result.duration.Seconds(),
+	}
+	if len(m.Platforms) == 0 && len(o.platform) != 0 {
+		m.Platforms = []string{o.platform}
+	}
+	if m.Existing {
+		m.Digest = result.existing[0][strings.LastIndex(result.existing[0], "@")+1:]
+		return m
+	}
+	if result.stats == nil {
+		return m
+	}
+	if len(result.images) != 0 {
+		m.Digest = result.stats.digestOf(result.images[0])
+	}
+	m.Cache.Steps, m.Cache.Cached = result.stats.cacheStats()
+	if m.Cache.Steps != 0 {
+		m.Cache.Ratio = float64(m.Cache.Cached) / float64(m.Cache.Steps)
+	}
+	m.PushSize = result.stats.pushedSize()
+	return m
+}
+
+// writeMetadata writes v to --metadata-file and prints it with --output-format json.
+func (o *Options) writeMetadata(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if len(o.metadataFile) != 0 {
+		if err := ioutil.WriteFile(o.metadataFile, data, 0644); err != nil {
+			return fmt.Errorf("write metadata: %s", err)
+		}
+	}
+	if o.format == formatJSON {
+		_, err = o.stdout.Write(data)
+	}
+	return err
+}
+
+// copyToClipboard copies image to the clipboard in a terminal.
+func (o *Options) copyToClipboard(image string) {
+	if !hasTTY {
+		return
+	}
+	if err := utils.SetClipboard(image); err == nil {
+		utils.FprintInfo(o.out, "镜像地址已复制到粘贴板")
+	}
+}
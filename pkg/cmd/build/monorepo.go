@@ -0,0 +1,335 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/iftechio/jki/pkg/dockerfile"
+	"github.com/iftechio/jki/pkg/git"
+	imageutil "github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/notify"
+	"github.com/iftechio/jki/pkg/progress"
+	"github.com/iftechio/jki/pkg/project"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+// imageNode is an image of the project in the dependency graph.
+type imageNode struct {
+	image project.Image
+	opts  *Options
+	// bases are base images in FROM lines, deps[base] is the image in the project built as base
+	bases []string
+	deps  map[string]*imageNode
+
+	result  *buildResult
+	skipped bool
+}
+
+// forImage returns options to build img of the project. Build args and labels given by flags
+// override those in the project file.
+func (o *Options) forImage(img project.Image) (*Options, error) {
+	sub := *o
+	sub.projectImages = nil
+	sub.imageName = img.Name
+	sub.context = img.Context
+	sub.dockerFileName = img.Dockerfile
+	sub.deployTargets = img.Deploy
+	sub.buildArgs = append(kvStrings(img.BuildArgs), o.buildArgs...)
+	sub.labels = append(kvStrings(img.Labels), o.labels...)
+	if o.useProjectRegistries && len(img.Registries) != 0 {
+		sub.dstRegistries = nil
+		for _, name := range img.Registries {
+			reg, ok := o.allRegistries[name]
+			if !ok {
+				return nil, fmt.Errorf("registry of image %s not found: %s", img.Name, name)
+			}
+			sub.dstRegistries = append(sub.dstRegistries, reg)
+		}
+	}
+	sub.cacheFromRefs, sub.cacheToRefs = nil, nil
+	if err := sub.completeCacheOptions(); err != nil {
+		return nil, err
+	}
+	// progress of parallel builds would overwrite each other
+	if o.parallel > 1 && o.progress != progress.JSON {
+		sub.progress = progress.Plain
+	}
+	return &sub, nil
+}
+
+// isRegistryPrefix reports whether domain is the prefix of a registry in config.
+func (o *Options) isRegistryPrefix(domain string) bool {
+	for _, reg := range o.allRegistries {
+		if reg.Prefix() == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// imageGraph returns selected images of the project. An image depends on another selected image
+// if it is built from the image without a domain or in one of the registries in config.
+func (o *Options) imageGraph() ([]*imageNode, error) {
+	nodes := make(map[string]*imageNode, len(o.projectImages))
+	var ordered []*imageNode
+	for _, name := range o.projectImages {
+		if _, ok := nodes[name]; ok {
+			continue
+		}
+		img, _ := o.project.ImageOf(name)
+		opts, err := o.forImage(img)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(img.Dockerfile)
+		if err != nil {
+			return nil, err
+		}
+		bases, err := dockerfile.BaseImages(f, opts.dockerfileOptions())
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %s", img.Dockerfile, err)
+		}
+		node := &imageNode{image: img, opts: opts, bases: dockerfile.Refs(bases), deps: make(map[string]*imageNode)}
+		nodes[name] = node
+		ordered = append(ordered, node)
+	}
+	for _, node := range ordered {
+		for _, base := range node.bases {
+			b := imageutil.FromString(base)
+			dep, ok := nodes[b.Repo]
+			if !ok || dep == node {
+				continue
+			}
+			if len(b.Domain) == 0 || o.isRegistryPrefix(b.Domain) {
+				node.deps[base] = dep
+			}
+		}
+	}
+	return ordered, nil
+}
+
+// sortImages sorts nodes into levels. Images of a level only depend on images of former levels.
+func sortImages(nodes []*imageNode) ([][]*imageNode, error) {
+	level := make(map[*imageNode]int, len(nodes))
+	visiting := make(map[*imageNode]bool, len(nodes))
+	var visit func(n *imageNode, path []string) (int, error)
+	visit = func(n *imageNode, path []string) (int, error) {
+		if l, ok := level[n]; ok {
+			return l, nil
+		}
+		path = append(path, n.image.Name)
+		if visiting[n] {
+			return 0, fmt.Errorf("circular dependency between images: %s", strings.Join(path, " -> "))
+		}
+		visiting[n] = true
+		l := 0
+		for _, dep := range n.deps {
+			dl, err := visit(dep, path)
+			if err != nil {
+				return 0, err
+			}
+			if dl+1 > l {
+				l = dl + 1
+			}
+		}
+		visiting[n] = false
+		level[n] = l
+		return l, nil
+	}
+	var levels [][]*imageNode
+	for _, n := range nodes {
+		l, err := visit(n, nil)
+		if err != nil {
+			return nil, err
+		}
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+	}
+	for _, n := range nodes {
+		levels[level[n]] = append(levels[level[n]], n)
+	}
+	return levels, nil
+}
+
+// imageIn returns the image in result pushed to the registry with prefix domain, or else the
+// image in the first target registry.
+func imageIn(result *buildResult, regs []*registry.Registry, domain string) string {
+	for i, reg := range regs {
+		if reg.Prefix() == domain {
+			return result.images[i]
+		}
+	}
+	return result.images[0]
+}
+
+// rewriteDockerfile replaces base images of FROM instructions in the Dockerfile fp according to
+// replace, and writes the result to a temporary directory, which should be removed by the caller.
+func rewriteDockerfile(fp string, opts dockerfile.Options, replace map[string]string) (string, error) {
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return "", err
+	}
+	data, err = dockerfile.Rewrite(data, opts, replace)
+	if err != nil {
+		return "", fmt.Errorf("rewrite %s: %s", fp, err)
+	}
+	dir, err := ioutil.TempDir("", "jki-dockerfile-")
+	if err != nil {
+		return "", err
+	}
+	fp = filepath.Join(dir, filepath.Base(fp))
+	if err := ioutil.WriteFile(fp, data, 0644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return fp, nil
+}
+
+// shouldSkip reports whether the image is unchanged since --since and none of its dependencies
+// is rebuilt.
+func (o *Options) shouldSkip(node *imageNode) (bool, error) {
+	if len(o.since) == 0 {
+		return false, nil
+	}
+	for _, dep := range node.deps {
+		if !dep.skipped {
+			return false, nil
+		}
+	}
+	changed, err := git.ChangedSince(o.since, node.image.Paths...)
+	if err != nil {
+		return false, err
+	}
+	return !changed, nil
+}
+
+// buildNode builds the image with base images in the project replaced by freshly built ones.
+func (o *Options) buildNode(ctx context.Context, node *imageNode) error {
+	replace := make(map[string]string)
+	for base, dep := range node.deps {
+		if dep.result != nil {
+			replace[base] = imageIn(dep.result, dep.opts.dstRegistries, imageutil.FromString(base).Domain)
+		}
+	}
+	opts := node.opts
+	if len(replace) != 0 {
+		fp, err := rewriteDockerfile(node.image.Dockerfile, opts.dockerfileOptions(), replace)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(filepath.Dir(fp))
+		// the rewritten Dockerfile is in a temp dir, <Dockerfile>.dockerignore is next to the original
+		opts.ignoreFor = node.image.Dockerfile
+		opts.dockerFileName = fp
+	}
+	utils.FprintInfo(o.out, fmt.Sprintf("开始构建镜像 %s", node.image.Name))
+	result, err := opts.buildImage(ctx)
+	if err != nil {
+		return fmt.Errorf("build %s: %s", node.image.Name, err)
+	}
+	node.result = result
+	if len(result.existing) != 0 {
+		utils.FprintInfo(o.out, fmt.Sprintf("镜像 %s 已存在, 跳过构建", node.image.Name))
+	}
+	return nil
+}
+
+// runProjectImages builds images of the project in dependency order. Images of the same level
+// are built in parallel.
+func (o *Options) runProjectImages(ctx context.Context) error {
+	start := time.Now()
+	nodes, err := o.imageGraph()
+	if err != nil {
+		return err
+	}
+	levels, err := sortImages(nodes)
+	if err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, o.parallel)
+	for _, level := range levels {
+		eg, ctx := errgroup.WithContext(ctx)
+		for _, node := range level {
+			node := node
+			node.skipped, err = o.shouldSkip(node)
+			if err != nil {
+				return err
+			}
+			if node.skipped {
+				fmt.Fprintf(o.out, "skip %s (unchanged since %s)\n", node.image.Name, o.since)
+				continue
+			}
+			eg.Go(func() error {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				return o.buildNode(ctx, node)
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+	}
+
+	var built, existing, skipped, hookErrs []string
+	unchanged := 0
+	metadata := ProjectMetadata{Images: []Metadata{}}
+	for _, node := range nodes {
+		if !node.skipped {
+			metadata.Images = append(metadata.Images, node.opts.metadata(node.result))
+		}
+		switch {
+		case node.skipped:
+			skipped = append(skipped, node.image.Name)
+		case len(node.result.existing) != 0:
+			existing = append(existing, node.result.existing...)
+			unchanged++
+		default:
+			built = append(built, node.result.allImages...)
+		}
+		if !node.skipped && node.result.hookErr != nil {
+			hookErrs = append(hookErrs, fmt.Sprintf("%s: %s", node.image.Name, node.result.hookErr))
+		}
+	}
+	sort.Strings(skipped)
+	metadata.Skipped = append([]string{}, skipped...)
+	if err := o.writeMetadata(metadata); err != nil {
+		return err
+	}
+	if !o.noPush && len(built) != 0 {
+		fmt.Fprintln(o.out, "镜像上传成功:")
+		for _, image := range built {
+			fmt.Fprintln(o.out, image)
+		}
+	}
+	if len(existing) != 0 {
+		fmt.Fprintln(o.out, "镜像已存在, 跳过构建:")
+		for _, ref := range existing {
+			fmt.Fprintln(o.out, ref)
+		}
+	}
+	if len(skipped) != 0 {
+		fmt.Fprintf(o.out, "跳过未改动的镜像: %s\n", strings.Join(skipped, ", "))
+	}
+	_ = notifyUser(fmt.Sprintf("%d built, %d skipped", len(nodes)-len(skipped)-unchanged, len(skipped)+unchanged), "镜像构建成功")
+	if !o.noPush && len(built) != 0 {
+		ev := notify.NewEvent(notify.BuildSuccess, built...)
+		ev.Duration = time.Since(start)
+		o.notifier.Notify(ev)
+	}
+	if len(hookErrs) != 0 {
+		return fmt.Errorf("hooks failed:\n  %s", strings.Join(hookErrs, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/iftechio/jki/pkg/config"
+	imageutil "github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+// runMultiPlatform builds `image-<os>-<arch>` in the docker daemon for every platform and pushes
+// it by digest, then pushes a manifest list referencing all of them as image and every image in
+// extraImages. Per platform tags only exist in the daemon and are removed after pushing, so
+// registries only get the manifest list. images[i] and extraImages[j][i] belong to
+// o.dstRegistries[i].
+// The size budget of each platform is checked before it is pushed.
+// Cache is only exported to cache references by single platform builds.
+func (o *Options) runMultiPlatform(ctx context.Context, buildOpts types.ImageBuildOptions, images []string, extraImages [][]string, budget config.SizeBudget) error {
+	// manifests[i] are manifests of platforms pushed to o.dstRegistries[i]
+	manifests := make([][]ocispec.Descriptor, len(images))
+	var localTags []string
+	defer func() {
+		if !o.noPush {
+			o.removeLocalTags(ctx, localTags)
+		}
+	}()
+	for _, platform := range o.platforms {
+		tags := make([]string, len(images))
+		for i, image := range images {
+			tags[i] = fmt.Sprintf("%s-%s", image, strings.ReplaceAll(platform, "/", "-"))
+		}
+		localTags = append(localTags, tags...)
+		opts := buildOpts
+		opts.Tags = tags
+		opts.Platform = platform
+		utils.FprintInfo(o.out, fmt.Sprintf("开始构建 %s 镜像", platform))
+		if err := o.build(ctx, opts); err != nil {
+			return err
+		}
+		// nothing is tagged in registries until all platforms are pushed
+		if err := o.checkBudget(ctx, tags[0], platform, budget); err != nil {
+			return err
+		}
+		if o.noPush {
+			continue
+		}
+		for i, reg := range o.dstRegistries {
+			desc, err := o.pushByDigest(ctx, reg, tags[i], images[i])
+			if err != nil {
+				return fmt.Errorf("push %s: %s", tags[i], err)
+			}
+			manifests[i] = append(manifests[i], desc)
+		}
+	}
+	if o.noPush {
+		return nil
+	}
+	annotations := ociAnnotations(buildOpts.Labels)
+	for i, image := range images {
+		if err := o.pushManifestList(ctx, o.dstRegistries[i], image, manifests[i], annotations); err != nil {
+			return err
+		}
+		for _, extra := range extraImages {
+			if err := o.pushManifestList(ctx, o.dstRegistries[i], extra[i], manifests[i], annotations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pushByDigest pushes the local image to the repository of image in reg without a tag, and
+// returns the descriptor of its manifest.
+func (o *Options) pushByDigest(ctx context.Context, reg *registry.Registry, local, image string) (ocispec.Descriptor, error) {
+	img := imageutil.FromString(image)
+	if err := reg.CreateRepoIfNotExists(img.Repo); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	rc, err := o.dockerClient.ImageSave(ctx, []string{local})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer rc.Close()
+	utils.FprintInfo(o.out, fmt.Sprintf("开始上传镜像 %s", local))
+	desc, pushed, err := reg.NewClient().PushArchive(ctx, img.Path(), rc)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	o.stats.addPushed(image, pushed)
+	utils.FprintInfo(o.out, fmt.Sprintf("%s -> %s@%s", local, img.Path(), desc.Digest))
+	return desc, nil
+}
+
+// removeLocalTags removes per platform tags from the docker daemon, images are kept if they have
+// other tags.
+func (o *Options) removeLocalTags(ctx context.Context, tags []string) {
+	for _, tag := range tags {
+		if _, err := o.dockerClient.ImageRemove(ctx, tag, types.ImageRemoveOptions{}); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: failed to remove %s: %s\n", tag, err)
+		}
+	}
+}
+
+func (o *Options) pushManifestList(ctx context.Context, reg *registry.Registry, image string, manifests []ocispec.Descriptor, annotations map[string]string) error {
+	client := reg.NewClient()
+	index := registry.Index{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeDockerManifestList,
+	}
+	for i, desc := range manifests {
+		if desc.MediaType == ocispec.MediaTypeImageManifest {
+			index.MediaType = ocispec.MediaTypeImageIndex
+		}
+		platform := imageutil.ParsePlatform(o.platforms[i])
+		desc.Platform = &platform
+		index.Manifests = append(index.Manifests, desc)
+	}
+	if index.MediaType == ocispec.MediaTypeImageIndex && len(annotations) != 0 {
+		// docker manifest lists have no annotations
+		index.Annotations = annotations
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	img := imageutil.FromString(image)
+	dgst, err := client.PutManifest(ctx, img.Path(), img.Tag, index.MediaType, data)
+	if err != nil {
+		return err
+	}
+	o.stats.setDigest(image, dgst.String())
+	utils.FprintInfo(o.out, fmt.Sprintf("多架构镜像上传成功: %s@%s", image, dgst))
+	return nil
+}
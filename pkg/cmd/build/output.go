@@ -0,0 +1,59 @@
+package build
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/filesync"
+)
+
+const (
+	outputTypeLocal = "local"
+	outputTypeTar   = "tar"
+)
+
+// parseOutput parses an --output value, `type=local,dest=<dir>` or `type=tar,dest=<file>`.
+// A plain path is a shorthand of `type=local,dest=<path>`.
+func parseOutput(s string) (types.ImageBuildOutput, error) {
+	out := types.ImageBuildOutput{Attrs: make(map[string]string)}
+	if !strings.ContainsRune(s, '=') {
+		out.Type = outputTypeLocal
+		out.Attrs["dest"] = s
+		return out, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return out, fmt.Errorf("invalid output: %s", s)
+		}
+		if kv[0] == "type" {
+			out.Type = kv[1]
+		} else {
+			out.Attrs[kv[0]] = kv[1]
+		}
+	}
+	switch out.Type {
+	case outputTypeLocal, outputTypeTar:
+	default:
+		return out, fmt.Errorf("unsupported output type: %s", out.Type)
+	}
+	if len(out.Attrs["dest"]) == 0 {
+		return out, fmt.Errorf("dest is required for output: %s", s)
+	}
+	return out, nil
+}
+
+// outputProvider receives the build result exported by the daemon through the session.
+func outputProvider(out types.ImageBuildOutput) session.Attachable {
+	dest := out.Attrs["dest"]
+	if out.Type == outputTypeLocal {
+		return filesync.NewFSSyncTargetDir(dest)
+	}
+	return filesync.NewFSSyncTarget(func(map[string]string) (io.WriteCloser, error) {
+		return os.Create(dest)
+	})
+}
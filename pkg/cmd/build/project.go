@@ -0,0 +1,90 @@
+package build
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iftechio/jki/pkg/project"
+)
+
+func kvStrings(m map[string]string) []string {
+	s := make([]string, 0, len(m))
+	for k, v := range m {
+		s = append(s, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(s)
+	return s
+}
+
+// completeProject fills options from the project file. Flags take precedence over the project
+// file, and build args and labels given by flags override those with the same key.
+func (o *Options) completeProject(cmd *cobra.Command, args []string) error {
+	p, err := project.Find(o.context)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		if o.all {
+			return fmt.Errorf("--all requires images in %s", project.FileName)
+		}
+		return nil
+	}
+	o.project = p
+	if names, ok := selectImages(p, o.all, args); ok {
+		o.projectImages = names
+		o.useProjectRegistries = !cmd.Flags().Changed("registry")
+		return nil
+	}
+	if o.all {
+		return fmt.Errorf("--all requires images in %s", p.Path(project.FileName))
+	}
+	flags := cmd.Flags()
+	if len(p.Name) != 0 && !flags.Changed("image-name") {
+		o.imageName = p.Name
+	}
+	if len(p.Context) != 0 && len(args) == 0 {
+		o.context = p.Path(p.Context)
+	}
+	if !flags.Changed("file") && len(args) == 0 {
+		switch {
+		case len(p.Dockerfile) != 0:
+			o.dockerFileName = p.Path(p.Dockerfile)
+		case len(p.Context) != 0:
+			o.dockerFileName = filepath.Join(o.context, "Dockerfile")
+		}
+	}
+	o.deployTargets = p.Deploy
+	o.buildArgs = append(kvStrings(p.BuildArgs), o.buildArgs...)
+	o.labels = append(kvStrings(p.Labels), o.labels...)
+	if !flags.Changed("registry") {
+		o.projectRegistries = p.Registries
+	}
+	return nil
+}
+
+// selectImages returns names of images in the project to build, which are all images with --all,
+// or args if all of them are names of images.
+func selectImages(p *project.Project, all bool, args []string) ([]string, bool) {
+	if len(p.Images) == 0 {
+		return nil, false
+	}
+	if all {
+		names := make([]string, len(p.Images))
+		for i, img := range p.Images {
+			names[i] = img.Name
+		}
+		return names, true
+	}
+	if len(args) == 0 {
+		return nil, false
+	}
+	for _, name := range args {
+		if _, ok := p.ImageOf(name); !ok {
+			return nil, false
+		}
+	}
+	return args, true
+}
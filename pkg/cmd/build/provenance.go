@@ -0,0 +1,81 @@
+package build
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iftechio/jki/pkg/git"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+// Keys of pre-defined annotations of the OCI image spec, which are also used as labels.
+const (
+	labelCreated  = "org.opencontainers.image.created"
+	labelSource   = "org.opencontainers.image.source"
+	labelRevision = "org.opencontainers.image.revision"
+	labelVersion  = "org.opencontainers.image.version"
+	labelRefName  = "org.opencontainers.image.ref.name"
+
+	// labelDirty is set if the image is built with uncommitted changes.
+	labelDirty = "io.jki.git.dirty"
+)
+
+// provenanceEnabled reports whether provenance labels should be added.
+func (o *Options) provenanceEnabled() bool {
+	if o.noProvenance {
+		return false
+	}
+	return o.config.ProvenanceLabels == nil || *o.config.ProvenanceLabels
+}
+
+// provenanceLabels returns labels tracing the image with tag back to the code. Labels from git
+// are skipped outside a git repository, or if the context is not from git.
+func provenanceLabels(tag string, created time.Time, fromGit bool) map[string]string {
+	labels := map[string]string{
+		labelCreated: created.UTC().Format(time.RFC3339),
+		labelRefName: tag,
+		labelVersion: tag,
+	}
+	if !fromGit {
+		return labels
+	}
+	if revision, err := git.GetCommitHash(); err == nil {
+		labels[labelRevision] = revision
+		labels[labelDirty] = strconv.FormatBool(git.HasChanges())
+	}
+	if version, err := git.Describe(); err == nil {
+		labels[labelVersion] = version
+	}
+	if origin, err := git.GetOriginURL(); err == nil && len(origin) != 0 {
+		labels[labelSource] = git.StripCredentials(origin)
+	}
+	return labels
+}
+
+// imageLabels returns labels of the image with tag. Provenance labels are overridden by labels in
+// config, which are overridden by labels of the project and --label.
+func (o *Options) imageLabels(tag string, created time.Time) map[string]string {
+	labels := make(map[string]string)
+	if o.provenanceEnabled() {
+		labels = provenanceLabels(tag, created, !o.archived)
+	}
+	for k, v := range o.config.Labels {
+		labels[k] = v
+	}
+	for k, v := range utils.ConvertKVStringsToMap(o.labels) {
+		labels[k] = v
+	}
+	return labels
+}
+
+// ociAnnotations returns labels with keys of pre-defined OCI annotations.
+func ociAnnotations(labels map[string]string) map[string]string {
+	annotations := make(map[string]string)
+	for k, v := range labels {
+		if strings.HasPrefix(k, "org.opencontainers.image.") {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
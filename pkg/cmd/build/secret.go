@@ -0,0 +1,101 @@
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
+
+	"github.com/iftechio/jki/pkg/config"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+// parseSecret parses a --secret value, e.g. `id=npmrc,src=~/.npmrc` or `id=token,env=GITHUB_TOKEN`.
+// The secret is read from the file named by id if neither src nor env is given.
+func parseSecret(s string) (config.Secret, error) {
+	var secret config.Secret
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return secret, fmt.Errorf("invalid secret: %s", s)
+		}
+		switch strings.ToLower(kv[0]) {
+		case "id":
+			secret.ID = kv[1]
+		case "src", "source":
+			secret.Src = kv[1]
+		case "env":
+			secret.Env = kv[1]
+		default:
+			return secret, fmt.Errorf("unexpected key %q in secret: %s", kv[0], s)
+		}
+	}
+	if len(secret.ID) == 0 {
+		return secret, fmt.Errorf("secret id is required: %s", s)
+	}
+	return secret, nil
+}
+
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		return filepath.Join(utils.HomeDir(), p[1:])
+	}
+	return p
+}
+
+func readSecret(secret config.Secret) ([]byte, error) {
+	if len(secret.Src) != 0 && len(secret.Env) != 0 {
+		return nil, fmt.Errorf("secret %s: src and env are mutually exclusive", secret.ID)
+	}
+	if len(secret.Env) != 0 {
+		v, ok := os.LookupEnv(secret.Env)
+		if !ok {
+			return nil, fmt.Errorf("secret %s: environment variable %s is not set", secret.ID, secret.Env)
+		}
+		return []byte(v), nil
+	}
+	src := secret.Src
+	if len(src) == 0 {
+		src = secret.ID
+	}
+	data, err := ioutil.ReadFile(expandHome(src))
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %s", secret.ID, err)
+	}
+	if len(data) > secretsprovider.MaxSecretSize {
+		return nil, fmt.Errorf("secret %s is too big, max size is 500KB", secret.ID)
+	}
+	return data, nil
+}
+
+// secretProvider reads all secrets into memory. Secrets given by flags override secrets
+// with the same id in config.
+func secretProvider(secrets []config.Secret) (session.Attachable, error) {
+	m := make(map[string][]byte, len(secrets))
+	for _, secret := range secrets {
+		data, err := readSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		m[secret.ID] = data
+	}
+	return secretsprovider.FromMap(m), nil
+}
+
+// parseSSH parses a --ssh value, `default` or `<id>[=<socket>|<key>[,<key>]]`. The agent
+// of SSH_AUTH_SOCK is forwarded if no path is given.
+func parseSSH(s string) sshprovider.AgentConfig {
+	kv := strings.SplitN(s, "=", 2)
+	cfg := sshprovider.AgentConfig{ID: kv[0]}
+	if len(kv) == 2 {
+		for _, p := range strings.Split(kv[1], ",") {
+			cfg.Paths = append(cfg.Paths, expandHome(p))
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,271 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	units "github.com/docker/go-units"
+
+	"github.com/iftechio/jki/pkg/config"
+	imageutil "github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+)
+
+// compareDeployed is the value of --compare to compare with the image of the first deploy target.
+const compareDeployed = "deployed"
+
+// instructionWidth is the max width of instructions printed in layer reports.
+const instructionWidth = 80
+
+// imageSize is the size of a built image.
+type imageSize struct {
+	image string
+	// platform is set for multi-platform images
+	platform string
+	layers   []registry.Layer
+	// compressed is set if sizes are read from the registry, or else they are sizes of layers
+	// in the local image
+	compressed bool
+}
+
+func (s *imageSize) total() int64 {
+	var total int64
+	for _, l := range s.layers {
+		total += l.Size
+	}
+	return total
+}
+
+func (s *imageSize) name() string {
+	if len(s.platform) != 0 {
+		return fmt.Sprintf("%s (%s)", s.image, s.platform)
+	}
+	return s.image
+}
+
+// instruction shortens the instruction in the image history that created a layer.
+func instruction(createdBy string) string {
+	s := strings.TrimSuffix(strings.TrimSpace(createdBy), "# buildkit")
+	switch {
+	case strings.HasPrefix(s, "/bin/sh -c #(nop) "):
+		s = strings.TrimPrefix(s, "/bin/sh -c #(nop) ")
+	case strings.HasPrefix(s, "/bin/sh -c "):
+		s = "RUN " + strings.TrimPrefix(s, "/bin/sh -c ")
+	case strings.HasPrefix(s, "RUN /bin/sh -c "):
+		s = "RUN " + strings.TrimPrefix(s, "RUN /bin/sh -c ")
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) == 0 {
+		return "<missing>"
+	}
+	if r := []rune(s); len(r) > instructionWidth {
+		s = string(r[:instructionWidth-3]) + "..."
+	}
+	return s
+}
+
+func formatDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + units.HumanSize(float64(-delta))
+	}
+	return "+" + units.HumanSize(float64(delta))
+}
+
+// localLayers returns layers of the image in the docker daemon from its history.
+func (o *Options) localLayers(ctx context.Context, image string) ([]registry.Layer, error) {
+	history, err := o.dockerClient.ImageHistory(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	var layers []registry.Layer
+	// the history is ordered from the top layer, and instructions like ENV have no layer
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Size == 0 {
+			continue
+		}
+		layers = append(layers, registry.Layer{Size: history[i].Size, CreatedBy: history[i].CreatedBy})
+	}
+	return layers, nil
+}
+
+// registryLayers returns layers of image in the registry for platform.
+func (o *Options) registryLayers(ctx context.Context, image, platform string) ([]registry.Layer, error) {
+	img := imageutil.FromString(image)
+	c, err := o.resolver.NewClient(img)
+	if err != nil {
+		return nil, err
+	}
+	return c.Layers(ctx, img.Path(), img.Reference(), imageutil.ParsePlatform(platform))
+}
+
+// imageSizes returns sizes of image for each platform built. Pushed images are read from the
+// registry, and images only built are read from the docker daemon. nil is returned if the image
+// is neither pushed nor in the docker daemon.
+func (o *Options) imageSizes(ctx context.Context, image string) ([]*imageSize, error) {
+	if o.noPush {
+		if len(o.output) != 0 || o.bkClient != nil || len(o.platforms) > 1 {
+			return nil, nil
+		}
+		layers, err := o.localLayers(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		return []*imageSize{{image: image, layers: layers}}, nil
+	}
+	platforms := o.platforms
+	if len(platforms) <= 1 {
+		platforms = []string{o.platform}
+	}
+	sizes := make([]*imageSize, len(platforms))
+	for i, platform := range platforms {
+		layers, err := o.registryLayers(ctx, image, platform)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = &imageSize{image: image, layers: layers, compressed: true}
+		if len(o.platforms) > 1 {
+			sizes[i].platform = platform
+		}
+	}
+	return sizes, nil
+}
+
+// compareRef returns the image --compare refers to, which is a tag of image, the image of the
+// first deploy target, or an image reference.
+func (o *Options) compareRef(image string) (string, error) {
+	switch {
+	case o.compare == compareDeployed:
+		return o.deployedImage(o.imageName, o.deployTargets)
+	case strings.ContainsAny(o.compare, "/:@"):
+		return o.compare, nil
+	}
+	img := imageutil.FromString(image)
+	img.Tag, img.Digest = o.compare, ""
+	return img.String(), nil
+}
+
+// printImageSize prints layers of the image from the base layer.
+func (o *Options) printImageSize(s *imageSize) {
+	kind := "uncompressed"
+	if s.compressed {
+		kind = "compressed"
+	}
+	fmt.Fprintf(o.out, "\nImage size of %s: %s %s in %d layers\n", s.name(), units.HumanSize(float64(s.total())), kind, len(s.layers))
+	w := tabwriter.NewWriter(o.out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "SIZE\t\tCREATED BY")
+	for _, l := range s.layers {
+		fmt.Fprintf(w, "%s\t\t%s\n", units.HumanSize(float64(l.Size)), instruction(l.CreatedBy))
+	}
+	w.Flush()
+}
+
+// printComparison prints the size delta between the image and ref, and layers not in ref.
+func (o *Options) printComparison(ctx context.Context, s *imageSize, ref string) error {
+	platform := s.platform
+	if len(platform) == 0 {
+		platform = o.platform
+	}
+	layers, err := o.registryLayers(ctx, ref, platform)
+	if err != nil {
+		return err
+	}
+	old := &imageSize{image: ref, layers: layers}
+	fmt.Fprintf(o.out, "\nCompared with %s: %s -> %s (%s)\n", ref, units.HumanSize(float64(old.total())),
+		units.HumanSize(float64(s.total())), formatDelta(s.total()-old.total()))
+	digests := make(map[string]bool, len(layers))
+	for _, l := range layers {
+		digests[l.Digest] = true
+	}
+	var added []registry.Layer
+	for _, l := range s.layers {
+		if !digests[l.Digest] {
+			added = append(added, l)
+		}
+	}
+	if len(added) == 0 {
+		fmt.Fprintln(o.out, "No new layers")
+		return nil
+	}
+	fmt.Fprintf(o.out, "New layers (%s):\n", units.HumanSize(float64((&imageSize{layers: added}).total())))
+	w := tabwriter.NewWriter(o.out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	for _, l := range added {
+		fmt.Fprintf(w, "%s\t\t%s\n", units.HumanSize(float64(l.Size)), instruction(l.CreatedBy))
+	}
+	return w.Flush()
+}
+
+// exceededBudget returns descriptions of sizes of s exceeding the budget.
+func exceededBudget(s *imageSize, maxSize, maxLayerSize int64) []string {
+	var exceeded []string
+	if total := s.total(); maxSize > 0 && total > maxSize {
+		exceeded = append(exceeded, fmt.Sprintf("%s is %s, larger than max-size %s", s.name(),
+			units.HumanSize(float64(total)), units.HumanSize(float64(maxSize))))
+	}
+	for _, l := range s.layers {
+		if maxLayerSize > 0 && l.Size > maxLayerSize {
+			exceeded = append(exceeded, fmt.Sprintf("layer `%s` of %s is %s, larger than max-layer-size %s",
+				instruction(l.CreatedBy), s.name(), units.HumanSize(float64(l.Size)), units.HumanSize(float64(maxLayerSize))))
+		}
+	}
+	return exceeded
+}
+
+// canCheckBudget reports whether the size budget can be checked before pushing, which requires
+// the image in the docker daemon. buildkitd pushes while building and --output exports no image.
+func (o *Options) canCheckBudget() bool {
+	return o.bkClient == nil && len(o.output) == 0
+}
+
+// checkBudget checks the size budget in config against the uncompressed size of the local image,
+// before it is pushed or tagged in registries. Only an exceeded budget is an error, sizes which
+// cannot be read are warned about.
+func (o *Options) checkBudget(ctx context.Context, local, platform string, budget config.SizeBudget) error {
+	if !budget.IsSet() {
+		return nil
+	}
+	layers, err := o.localLayers(ctx, local)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: size budget of %s is not checked, failed to get size of %s: %s\n", o.imageName, local, err)
+		return nil
+	}
+	s := &imageSize{image: o.imageName, platform: platform, layers: layers}
+	exceeded := exceededBudget(s, budget.Image, budget.Layer)
+	if len(exceeded) == 0 {
+		return nil
+	}
+	if budget.Warn {
+		for _, e := range exceeded {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s\n", e)
+		}
+		return nil
+	}
+	return fmt.Errorf("size budget exceeded, not pushed:\n  %s", strings.Join(exceeded, "\n  "))
+}
+
+// reportImageSize prints layers of the built image and compares it with --compare. Sizes which
+// cannot be read are warned about.
+func (o *Options) reportImageSize(ctx context.Context, image string) {
+	sizes, err := o.imageSizes(ctx, image)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: failed to get size of %s: %s\n", image, err)
+		return
+	}
+	ref := ""
+	if len(o.compare) != 0 && len(sizes) != 0 {
+		ref, err = o.compareRef(image)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "WARNING: failed to resolve the image to compare with: %s\n", err)
+		}
+	}
+	for _, s := range sizes {
+		o.printImageSize(s)
+		if len(ref) != 0 {
+			if err := o.printComparison(ctx, s, ref); err != nil {
+				_, _ = fmt.Fprintf(os.Stderr, "WARNING: failed to compare with %s: %s\n", ref, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package build
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/opencontainers/go-digest"
+)
+
+// buildStats collects metrics of a build from progress of buildkit and messages of the docker
+// daemon. Builds of multiple platforms and pushes to multiple registries share it concurrently.
+type buildStats struct {
+	mu sync.Mutex
+	// cached[v] reports whether the completed step v is cached, by buildkit
+	cached       map[digest.Digest]bool
+	vertexNames  map[digest.Digest]string
+	steps        int
+	cachedSteps  int
+	pushedLayers map[string]int64
+	// digests[image] is the digest of the pushed image
+	digests map[string]string
+}
+
+func newBuildStats() *buildStats {
+	return &buildStats{
+		cached:       make(map[digest.Digest]bool),
+		vertexNames:  make(map[digest.Digest]string),
+		pushedLayers: make(map[string]int64),
+		digests:      make(map[string]string),
+	}
+}
+
+// observeSolveStatus records steps and pushed layers of buildkit.
+func (s *buildStats) observeSolveStatus(status *bkclient.SolveStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range status.Vertexes {
+		s.vertexNames[v.Digest] = v.Name
+		// internal steps like loading the Dockerfile are never cached
+		if v.Completed != nil && !strings.HasPrefix(v.Name, "[internal]") {
+			s.cached[v.Digest] = v.Cached
+		}
+	}
+	for _, vs := range status.Statuses {
+		if strings.HasPrefix(s.vertexNames[vs.Vertex], "pushing") && vs.Total != 0 {
+			s.pushedLayers[vs.Vertex.String()+vs.ID] = vs.Total
+		}
+	}
+}
+
+// observeBuildMessage records steps of the legacy builder.
+func (s *buildStats) observeBuildMessage(msg jsonmessage.JSONMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case strings.HasPrefix(msg.Stream, "Step "):
+		s.steps++
+	case strings.Contains(msg.Stream, "Using cache"):
+		s.cachedSteps++
+	}
+}
+
+// observePushMessage records layers pushed and the digest of image. Layers already existing in
+// the registry are not counted.
+func (s *buildStats) observePushMessage(image string, msg jsonmessage.JSONMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if msg.Status == "Pushing" && msg.Progress != nil && msg.Progress.Total != 0 {
+		s.pushedLayers[image+"@"+msg.ID] = msg.Progress.Total
+	}
+	if msg.Aux != nil {
+		var result types.PushResult
+		if err := json.Unmarshal(*msg.Aux, &result); err == nil && len(result.Digest) != 0 {
+			s.digests[image] = result.Digest
+		}
+	}
+}
+
+// addPushed records size of blobs pushed for image by other means than the docker daemon.
+func (s *buildStats) addPushed(image string, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushedLayers[image] += size
+}
+
+// setDigest records the digest of image pushed by other means than the docker daemon.
+func (s *buildStats) setDigest(image, dgst string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.digests[image] = dgst
+}
+
+// cacheStats returns the number of steps and cached steps.
+func (s *buildStats) cacheStats() (total, cached int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cached) == 0 {
+		return s.steps, s.cachedSteps
+	}
+	for _, c := range s.cached {
+		total++
+		if c {
+			cached++
+		}
+	}
+	return total, cached
+}
+
+// pushedSize returns the total size of layers pushed.
+func (s *buildStats) pushedSize() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var size int64
+	for _, n := range s.pushedLayers {
+		size += n
+	}
+	return size
+}
+
+func (s *buildStats) digestOf(image string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.digests[image]
+}
+
+// tee returns a channel whose statuses are observed and forwarded to ch. ch is closed after the
+// returned channel is closed.
+func (s *buildStats) tee(ch chan *bkclient.SolveStatus) chan *bkclient.SolveStatus {
+	in := make(chan *bkclient.SolveStatus)
+	go func() {
+		defer close(ch)
+		for status := range in {
+			s.observeSolveStatus(status)
+			ch <- status
+		}
+	}()
+	return in
+}
@@ -1,6 +1,49 @@
 package config
 
 const defaultConfig = `default-registry: ali
+# jki build 默认推送到的 registry 列表, 不设置的话只推送到 default-registry
+#push-to:
+#- ali
+#- aws-tokyo
+# jki build 自动生成 tag 的模板, 可用的变量见 jki build -h
+#tag-template: "{branch}-{short_sha}"
+# jki build 会自动添加 org.opencontainers.image.* 标签 (commit, 仓库地址, 构建时间等), 设为 false 关闭
+#provenance-labels: false
+# jki build 给所有镜像添加的标签
+#labels:
+#  team: infra
+# jki build 上传的构建目录超过这个大小时会给出警告, 设为 0 关闭
+#context-size-warning: 500MB
+# build, cp, deploy, transferimage 的结果通知, type 可以是 webhook (默认), slack, dingtalk, lark, wecom, 失败时会重试
+#notifications:
+#- type: dingtalk
+#  url: https://oapi.dingtalk.com/robot/send?access_token=xxx
+#  # 钉钉、飞书机器人开启了签名校验时设置
+#  secret: SECxxx
+#  # 只发送匹配的事件, 不设置的话发送所有事件
+#  events: ["build.*", "deploy.*"]
+#- url: https://example.com/hooks/jki
+#  headers:
+#    Authorization: Bearer xxx
+# build, push, cp, deploy 前后执行的 shell 命令, pre 命令失败时中止操作, 可用的环境变量见 README
+#hooks:
+#  deploy:
+#    post:
+#    - curl -fsS -d "image=$JKI_IMAGE&cluster=$JKI_CLUSTER" https://release.example.com/api/deploys
+# 按镜像名设置的项目配置
+#projects:
+#  my-app:
+#    tag-template: "release-{commit_date}-{short_sha}"
+#    # 构建时通过 RUN --mount=type=secret,id=npmrc 使用, src 和 env 二选一
+#    secrets:
+#    - id: npmrc
+#      src: ~/.npmrc
+#    - id: gh_token
+#      env: GITHUB_TOKEN
+#    # 镜像跟单层未压缩的大小预算, 推送前检查, 超过时 jki build 失败且不推送, size-check 设为 warn 时只给出警告
+#    max-size: 300MB
+#    max-layer-size: 100MB
+#    size-check: fail
 registries:
 - name: ali
   aliyun:
@@ -19,6 +62,9 @@ registries:
     namespace: test
 
     region: cn-hangzhou
+
+  # jki build --cache-from type=registry --cache-to type=registry 使用的缓存仓库, 默认是 {image}-buildcache
+  #cache_repo: "{image}-buildcache"
 #- name: ali-ee
 #  aliyun_ee:
 #    #username: user
@@ -4,16 +4,20 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/docker/docker/pkg/term"
 	"github.com/spf13/cobra"
 
 	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/hook"
 	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/notify"
+	"github.com/iftechio/jki/pkg/progress"
+	"github.com/iftechio/jki/pkg/project"
 	"github.com/iftechio/jki/pkg/registry"
 	"github.com/iftechio/jki/pkg/utils"
 )
@@ -24,6 +28,16 @@ type Options struct {
 	dstRegistry  *registry.Registry
 	saveImage    bool
 	platform     string
+	progress     progress.Mode
+	timings      *progress.Timings
+	notifier     *notify.Notifier
+	hooks        *hook.Runner
+
+	allTags    bool
+	tagPattern string
+	since      string
+	sinceTime  time.Time
+	dryRun     bool
 }
 
 func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
@@ -50,6 +64,28 @@ func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string)
 	}
 	o.dstRegistry = registries[dstReg]
 	o.platform = f.Platform()
+	o.progress, err = f.Progress()
+	if err != nil {
+		return err
+	}
+	o.timings = f.Timings()
+	cfg, err := f.LoadConfig()
+	if err != nil {
+		return err
+	}
+	o.notifier, err = notify.New(cfg.Notifications)
+	if err != nil {
+		return err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	p, err := project.Find(wd)
+	if err != nil {
+		return err
+	}
+	o.hooks = hook.New(cfg, p)
 	return nil
 }
 
@@ -57,14 +93,80 @@ func (o *Options) Validate(args []string) error {
 	if len(args) < 1 {
 		return fmt.Errorf("wrong number of arguments")
 	}
+	if len(o.tagPattern) != 0 {
+		if _, err := path.Match(o.tagPattern, ""); err != nil {
+			return fmt.Errorf("invalid tag pattern: %s", err)
+		}
+	}
+	if len(o.since) != 0 {
+		t, err := parseTime(o.since)
+		if err != nil {
+			return err
+		}
+		o.sinceTime = t
+	}
+	if o.dryRun && !o.copiesTags() {
+		return fmt.Errorf("--dry-run requires --all-tags, --tags or --since")
+	}
 	return nil
 }
 
+// copiesTags reports whether tags of a repository are copied instead of a single image.
+func (o *Options) copiesTags() bool {
+	return o.allTags || len(o.tagPattern) != 0 || !o.sinceTime.IsZero()
+}
+
 func (o *Options) Run(args []string) error {
-	frImg := args[0]
-	ctx := context.TODO()
-	termFd, isTerm := term.GetFdInfo(os.Stdout)
+	start := time.Now()
+	if o.copiesTags() {
+		copied, err := o.copyTags(context.TODO(), args[0])
+		o.notifyCopy(args[0], copied, start, err)
+		if err != nil || len(copied) == 0 {
+			return err
+		}
+		return o.hooks.Post(hook.Copy, hook.Vars{Images: copied, Source: args[0]})
+	}
 
+	err := o.hooks.Pre(hook.Copy, hook.Vars{Source: args[0]})
+	if err != nil {
+		o.notifyCopy(args[0], nil, start, err)
+		return err
+	}
+	result, err := o.copyImage(context.TODO(), args[0])
+	if err != nil {
+		o.notifyCopy(args[0], nil, start, err)
+		return err
+	}
+
+	result.print()
+	if !result.skipped {
+		o.notifyCopy(result.from, []string{result.to}, start, nil)
+	}
+	utils.PrintInfo("镜像复制成功")
+	utils.PrintInfo("镜像地址已复制到粘贴板")
+	utils.SetClipboard(result.to)
+	return o.hooks.Post(hook.Copy, hook.Vars{Images: []string{result.to}, Digest: result.dstDigest, Source: result.from})
+}
+
+// notifyCopy sends cp.success or cp.failure to webhooks in config. Nothing is sent if nothing is
+// copied.
+func (o *Options) notifyCopy(src string, copied []string, start time.Time, err error) {
+	name := notify.CopySuccess
+	switch {
+	case err != nil:
+		name = notify.CopyFailure
+	case len(copied) == 0:
+		return
+	}
+	ev := notify.NewEvent(name, copied...)
+	ev.Source = src
+	ev.Duration = time.Since(start)
+	ev.Err = err
+	o.notifier.Notify(ev)
+}
+
+// copyWithDocker copies frImg to the destination registry through the docker daemon and returns the new image.
+func (o *Options) copyWithDocker(ctx context.Context, frImg string) (string, error) {
 	_, _, err := o.dockerClient.ImageInspectWithRaw(ctx, frImg)
 	if err != nil {
 		if client.IsErrNotFound(err) {
@@ -72,31 +174,31 @@ func (o *Options) Run(args []string) error {
 			// try to pull from registry
 			reg, err := o.resolver.ResolveRegistryByImage(frImg)
 			if err != nil {
-				return err
+				return "", err
 			}
 			frToken, err := reg.GetAuthToken()
 			if err != nil {
-				return err
+				return "", err
 			}
 			frImg, err = o.completeImageStr(frImg, reg)
 			if err != nil {
-				return err
+				return "", err
 			}
 
 			out, err := o.dockerClient.ImagePull(ctx, frImg, types.ImagePullOptions{RegistryAuth: frToken, Platform: o.platform})
 			if err != nil {
-				return err
+				return "", err
 			}
 
 			utils.PrintInfo(fmt.Sprintf("Pulling %s", frImg))
 			defer out.Close()
 
-			err = jsonmessage.DisplayJSONMessagesStream(out, os.Stdout, termFd, isTerm, nil)
+			err = progress.DisplayJSONMessages(out, o.progress, os.Stdout, o.timings, nil)
 			if err != nil {
-				return err
+				return "", err
 			}
 		} else {
-			return err
+			return "", err
 		}
 	}
 
@@ -104,7 +206,7 @@ func (o *Options) Run(args []string) error {
 	toReg := o.dstRegistry
 	err = toReg.CreateRepoIfNotExists(img.Repo)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	img.Domain = toReg.Prefix()
@@ -113,30 +215,26 @@ func (o *Options) Run(args []string) error {
 
 	toToken, err := toReg.GetAuthToken()
 	if err != nil {
-		return err
+		return "", err
 	}
 	utils.PrintInfo(fmt.Sprintf("Pushing %s", toImg))
 	pushOut, err := o.dockerClient.ImagePush(ctx, toImg, types.ImagePushOptions{RegistryAuth: toToken, Platform: o.platform})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	utils.PrintInfo(fmt.Sprintf("Pushing %s", toImg))
 	defer pushOut.Close()
 
-	err = jsonmessage.DisplayJSONMessagesStream(pushOut, os.Stdout, termFd, isTerm, nil)
+	err = progress.DisplayJSONMessages(pushOut, o.progress, os.Stdout, o.timings, nil)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if !o.saveImage {
 		o.removeImages(ctx, frImg, toImg)
 	}
-
-	utils.PrintInfo("镜像复制成功")
-	utils.PrintInfo("镜像地址已复制到粘贴板")
-	utils.SetClipboard(toImg)
-	return nil
+	return toImg, nil
 }
 
 func NewCopyOptions() *Options {
@@ -148,6 +246,14 @@ func NewCmdCp(f factory.Factory) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cp <IMAGE> [REGISTRY NAME]",
 		Short: "Copy images from one registry to another",
+		Example: `  # Copy nginx:alpine to the default registry
+  jki cp nginx:alpine
+
+  # Copy all tags of foo/bar matching v1.* to the registry named aws-tokyo
+  jki cp foo/bar aws-tokyo --tags 'v1.*'
+
+  # Show which tags created since 2024-01-01 would be copied
+  jki cp foo/bar --all-tags --since 2024-01-01 --dry-run`,
 		Run: func(cmd *cobra.Command, args []string) {
 			utils.CheckError(o.Complete(f, cmd, args))
 			utils.CheckError(o.Validate(args))
@@ -157,6 +263,10 @@ func NewCmdCp(f factory.Factory) *cobra.Command {
 
 	flags := cmd.Flags()
 	flags.BoolVar(&o.saveImage, "save-image", o.saveImage, "The local image will not be deleted after the copy is completed")
+	flags.BoolVar(&o.allTags, "all-tags", false, "Copy all tags of the repository")
+	flags.StringVar(&o.tagPattern, "tags", "", "Copy tags of the repository matching the glob pattern, e.g. 'v1.*'")
+	flags.StringVar(&o.since, "since", "", "Copy tags of the repository created since the date, e.g. 2024-01-01")
+	flags.BoolVar(&o.dryRun, "dry-run", false, "Print the copy plan of --all-tags, --tags or --since without copying")
 	return cmd
 }
 
@@ -0,0 +1,121 @@
+package cp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/iftechio/jki/pkg/hook"
+	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+type copyItem struct {
+	from     string
+	to       string
+	upToDate bool
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s, expected format: 2006-01-02 or RFC3339", s)
+}
+
+// copyTags copies tags of the repository repoStr selected by --all-tags, --tags and --since, and
+// returns images copied.
+func (o *Options) copyTags(ctx context.Context, repoStr string) ([]string, error) {
+	src := image.FromString(repoStr)
+	src.Digest = ""
+	srcClient, err := o.resolver.NewClient(src)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := srcClient.ListTags(ctx, src.Path())
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tags)
+
+	dstClient := o.dstRegistry.NewClient()
+	platform := image.ParsePlatform(o.platform)
+	var plan []copyItem
+	for _, tag := range tags {
+		if len(o.tagPattern) != 0 {
+			if ok, _ := path.Match(o.tagPattern, tag); !ok {
+				continue
+			}
+		}
+		src.Tag = tag
+		srcManifest, err := srcClient.ResolveManifest(ctx, src.Path(), tag, platform)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %s", src.String(), err)
+		}
+		if !o.sinceTime.IsZero() {
+			config, err := srcClient.GetConfig(ctx, src.Path(), &srcManifest.Manifest)
+			if err != nil {
+				return nil, fmt.Errorf("get config of %s: %s", src.String(), err)
+			}
+			if config.Created == nil || config.Created.Before(o.sinceTime) {
+				continue
+			}
+		}
+
+		dst := o.dstRegistry.Image(src.Repo, tag)
+		item := copyItem{from: src.String(), to: dst.String()}
+		dstDesc, err := dstClient.HeadManifest(ctx, dst.Path(), tag)
+		switch {
+		case err == registry.ErrNotFound:
+		case err != nil:
+			return nil, fmt.Errorf("resolve %s: %s", dst.String(), err)
+		default:
+			for _, dgst := range srcManifest.Digests() {
+				if dstDesc.Digest.String() == dgst {
+					item.upToDate = true
+				}
+			}
+		}
+		plan = append(plan, item)
+	}
+
+	if len(plan) == 0 {
+		fmt.Println("Found no tag to copy")
+		return nil, nil
+	}
+	upToDate := 0
+	for _, item := range plan {
+		if item.upToDate {
+			upToDate++
+			fmt.Printf("skip %s (up to date)\n", item.from)
+		} else {
+			fmt.Printf("copy %s -> %s\n", item.from, item.to)
+		}
+	}
+	if o.dryRun || upToDate == len(plan) {
+		return nil, nil
+	}
+	if err := o.hooks.Pre(hook.Copy, hook.Vars{Source: repoStr}); err != nil {
+		return nil, err
+	}
+
+	var copied []string
+	for _, item := range plan {
+		if item.upToDate {
+			continue
+		}
+		result, err := o.copyImage(ctx, item.from)
+		if err != nil {
+			return copied, fmt.Errorf("copy %s: %s", item.from, err)
+		}
+		result.print()
+		copied = append(copied, result.to)
+	}
+	utils.PrintInfo(fmt.Sprintf("镜像复制成功: %d copied, %d skipped", len(copied), len(plan)-len(copied)))
+	return copied, nil
+}
@@ -0,0 +1,123 @@
+package cp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/client"
+
+	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+type copyResult struct {
+	from      string
+	to        string
+	srcDigest string
+	dstDigest string
+	skipped   bool
+}
+
+func (r *copyResult) print() {
+	if r.skipped {
+		fmt.Printf("%s is up to date\n", r.to)
+	}
+	if len(r.srcDigest) != 0 {
+		fmt.Printf("source:      %s@%s\n", r.from, r.srcDigest)
+	}
+	fmt.Printf("destination: %s@%s\n", r.to, r.dstDigest)
+}
+
+func containsDigest(digests []string, dgst string) bool {
+	for _, d := range digests {
+		if d == dgst {
+			return true
+		}
+	}
+	return false
+}
+
+// copyImage copies frImg to the destination registry through the registry API, which keeps the
+// manifest digest unchanged. Blobs are mounted instead of transferred if both registries are on
+// the same host. Images which only exist locally are pushed through the docker daemon.
+func (o *Options) copyImage(ctx context.Context, frImg string) (*copyResult, error) {
+	reg, err := o.resolver.ResolveRegistryByImage(frImg)
+	if err != nil {
+		return nil, err
+	}
+	frImg, err = o.completeImageStr(frImg, reg)
+	if err != nil {
+		return nil, err
+	}
+	src := image.FromString(frImg)
+	srcClient := registry.NewClient(reg, src.Host())
+	srcManifest, err := srcClient.ResolveManifest(ctx, src.Path(), src.Reference(), image.ParsePlatform(o.platform))
+	if err != nil {
+		if _, _, ierr := o.dockerClient.ImageInspectWithRaw(ctx, frImg); ierr != nil {
+			if client.IsErrNotFound(ierr) {
+				return nil, fmt.Errorf("resolve %s: %s", frImg, err)
+			}
+			// the docker daemon is optional, the registry error matters
+			return nil, fmt.Errorf("resolve %s: %s (local lookup: %s)", frImg, err, ierr)
+		}
+		// only exists locally
+		return o.copyLocalImage(ctx, frImg)
+	}
+
+	dst := o.dstRegistry.Image(src.Repo, src.Tag)
+	dstClient := o.dstRegistry.NewClient()
+	result := &copyResult{
+		from:      frImg,
+		to:        dst.String(),
+		srcDigest: srcManifest.Desc.Digest.String(),
+	}
+
+	dstDesc, err := dstClient.HeadManifest(ctx, dst.Path(), dst.Tag)
+	switch {
+	case err == registry.ErrNotFound:
+	case err != nil:
+		return nil, fmt.Errorf("resolve %s: %s", dst.String(), err)
+	case containsDigest(srcManifest.Digests(), dstDesc.Digest.String()):
+		result.dstDigest = dstDesc.Digest.String()
+		result.skipped = true
+		return result, nil
+	}
+
+	err = o.dstRegistry.CreateRepoIfNotExists(src.Repo)
+	if err != nil {
+		return nil, err
+	}
+	utils.PrintInfo(fmt.Sprintf("Copying %s to %s", frImg, dst.String()))
+	err = registry.CopyManifest(ctx, srcClient, src.Path(), dstClient, dst.Path(), srcManifest.Desc, srcManifest.Raw, dst.Tag)
+	if err != nil {
+		return nil, err
+	}
+
+	dstDesc, err = dstClient.HeadManifest(ctx, dst.Path(), dst.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("verify %s: %s", dst.String(), err)
+	}
+	result.dstDigest = dstDesc.Digest.String()
+	if result.dstDigest != result.srcDigest {
+		return nil, fmt.Errorf("digest mismatch after copy: source %s@%s, destination %s@%s", frImg, result.srcDigest, dst.String(), result.dstDigest)
+	}
+	return result, nil
+}
+
+func (o *Options) copyLocalImage(ctx context.Context, frImg string) (*copyResult, error) {
+	toImg, err := o.copyWithDocker(ctx, frImg)
+	if err != nil {
+		return nil, err
+	}
+	dst := image.FromString(toImg)
+	dstDesc, err := o.dstRegistry.NewClient().HeadManifest(ctx, dst.Path(), dst.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("verify %s: %s", toImg, err)
+	}
+	return &copyResult{
+		from:      frImg,
+		to:        toImg,
+		dstDigest: dstDesc.Digest.String(),
+	}, nil
+}
@@ -2,7 +2,9 @@ package deploy
 
 import (
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	v1 "k8s.io/api/core/v1"
@@ -15,7 +17,10 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 
 	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/hook"
 	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/notify"
+	"github.com/iftechio/jki/pkg/project"
 	"github.com/iftechio/jki/pkg/utils"
 )
 
@@ -27,14 +32,23 @@ func formatGroupKind(gk schema.GroupKind) string {
 	return kind
 }
 
-type Options struct {
+// target is a workload whose container image is updated.
+type target struct {
+	namespace string
+	spec      string
 	container string
 	image     string
+}
+
+type Options struct {
+	container string
 	dryRun    bool
 
-	namespace string
-	spec      string
-	builder   *resource.Builder
+	targets    []target
+	newBuilder func() *resource.Builder
+	notifier   *notify.Notifier
+	hooks      *hook.Runner
+	cluster    string
 }
 
 func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
@@ -49,6 +63,25 @@ func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string)
 		err  error
 	)
 
+	cfg, err := f.LoadConfig()
+	if err != nil {
+		return err
+	}
+	o.notifier, err = notify.New(cfg.Notifications)
+	if err != nil {
+		return err
+	}
+	o.cluster = f.Cluster()
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	p, err := project.Find(wd)
+	if err != nil {
+		return err
+	}
+	o.hooks = hook.New(cfg, p)
+
 	switch len(args) {
 	case 1:
 		img = image.FromString(args[0])
@@ -78,18 +111,24 @@ func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string)
 	case 3:
 		img = image.FromString(args[2])
 		spec = args[0] + "/" + args[1]
+	case 0:
+		// deploy targets are read from the project file
+		return o.completeProject(f, p)
 	default:
 		return fmt.Errorf("unknown args: %v", args)
 	}
-	o.spec = spec
-	o.image = img.String()
 
-	o.namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
+	namespace, _, err := f.ToRawKubeConfigLoader().Namespace()
 	if err != nil {
 		return err
 	}
-
-	o.builder = f.NewBuilder()
+	o.targets = []target{{
+		namespace: namespace,
+		spec:      spec,
+		container: o.container,
+		image:     img.String(),
+	}}
+	o.newBuilder = f.NewBuilder
 	return nil
 }
 
@@ -98,12 +137,66 @@ func (o *Options) Validate() error {
 }
 
 func (o *Options) Run() error {
-	result := o.builder.
+	var hookErrs []string
+	for _, t := range o.targets {
+		if o.dryRun {
+			if err := o.deploy(t); err != nil {
+				return err
+			}
+			continue
+		}
+		start := time.Now()
+		vars := hook.Vars{
+			Images:    []string{t.image},
+			Namespace: t.namespace,
+			Workload:  t.spec,
+			Cluster:   o.cluster,
+		}
+		err := o.hooks.Pre(hook.Deploy, vars)
+		if err == nil {
+			err = o.deploy(t)
+		}
+		o.notifyDeploy(t, start, err)
+		if err != nil {
+			// the remaining targets are not deployed, report hooks failed on deployed ones too
+			if len(hookErrs) != 0 {
+				return fmt.Errorf("%s\nhooks failed:\n  %s", err, strings.Join(hookErrs, "\n  "))
+			}
+			return err
+		}
+		// post hooks are not fatal, the target is deployed anyway
+		if err := o.hooks.Post(hook.Deploy, vars); err != nil {
+			hookErrs = append(hookErrs, err.Error())
+		}
+	}
+	if len(hookErrs) != 0 {
+		return fmt.Errorf("hooks failed:\n  %s", strings.Join(hookErrs, "\n  "))
+	}
+	return nil
+}
+
+// notifyDeploy sends deploy.success or deploy.failure of the target to webhooks in config.
+func (o *Options) notifyDeploy(t target, start time.Time, err error) {
+	name := notify.DeploySuccess
+	if err != nil {
+		name = notify.DeployFailure
+	}
+	ev := notify.NewEvent(name, t.image)
+	ev.Cluster = o.cluster
+	ev.Namespace = t.namespace
+	ev.Workload = t.spec
+	ev.Duration = time.Since(start)
+	ev.Err = err
+	o.notifier.Notify(ev)
+}
+
+func (o *Options) deploy(t target) error {
+	result := o.newBuilder().
 		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
 		ContinueOnError().
-		NamespaceParam(o.namespace).DefaultNamespace().
+		NamespaceParam(t.namespace).DefaultNamespace().
 		Flatten().
-		ResourceTypeOrNameArgs(false, o.spec).
+		ResourceTypeOrNameArgs(false, t.spec).
 		Latest().
 		Do()
 
@@ -121,27 +214,12 @@ func (o *Options) Run() error {
 			return err
 		}
 		_, err = updatePodSpecForObject(info.Object, func(spec *v1.PodSpec) error {
-			totalContainers := len(spec.InitContainers) + len(spec.Containers)
-			if len(o.container) == 0 {
-				if totalContainers == 1 && len(spec.Containers) > 0 {
-					spec.Containers[0].Image = o.image
-					return nil
-				}
-				return fmt.Errorf("ambiguous container: please specify container name")
-			}
-			for i, ct := range spec.InitContainers {
-				if ct.Name == o.container {
-					spec.InitContainers[i].Image = o.image
-					return nil
-				}
-			}
-			for i, ct := range spec.Containers {
-				if ct.Name == o.container {
-					spec.Containers[i].Image = o.image
-					return nil
-				}
+			c, err := findContainer(spec, t.container)
+			if err != nil {
+				return err
 			}
-			return fmt.Errorf("container not found: %s", o.container)
+			c.Image = t.image
+			return nil
 		})
 		if err != nil {
 			return err
@@ -183,7 +261,7 @@ func (o *Options) Run() error {
 func NewCmdDeploy(f factory.Factory) *cobra.Command {
 	o := Options{}
 	cmd := &cobra.Command{
-		Use:     "deploy [resource/name] <image>",
+		Use:     "deploy [[resource/name] <image>]",
 		Short:   "Update container image of resources",
 		Aliases: []string{"d"},
 		Long: `Update existing container image of resources.
@@ -192,7 +270,9 @@ func NewCmdDeploy(f factory.Factory) *cobra.Command {
 
   pod (po), deployment (deploy), daemonset (ds), statefulset (sts), cronjob (cj)
 
-If there are multiple containers in the pod, you MUST specify the target container name.`,
+If there are multiple containers in the pod, you MUST specify the target container name.
+
+Without arguments, the image built by 'jki build' is deployed to targets in .jki/project.yaml.`,
 		Example: ` # Update image of deployment nginx to 'nginx:alpine'
   jki deploy nginx:alpine
 
@@ -206,7 +286,10 @@ If there are multiple containers in the pod, you MUST specify the target contain
   jki deploy cronjob bar alpine:3.10
 
   # Update image of app container of deployment nginx to 'nginx:alpine'
-  jki deploy -c app nginx:alpine`,
+  jki deploy -c app nginx:alpine
+
+  # Deploy the image built from the current commit to targets in the project file
+  jki deploy`,
 		Run: func(cmd *cobra.Command, args []string) {
 			utils.CheckError(o.Complete(f, cmd, args))
 			utils.CheckError(o.Validate())
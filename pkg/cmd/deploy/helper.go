@@ -13,6 +13,27 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// findContainer returns the container name in spec, or the only container if name is empty.
+func findContainer(spec *corev1.PodSpec, name string) (*corev1.Container, error) {
+	if len(name) == 0 {
+		if len(spec.InitContainers)+len(spec.Containers) == 1 && len(spec.Containers) > 0 {
+			return &spec.Containers[0], nil
+		}
+		return nil, fmt.Errorf("ambiguous container: please specify container name")
+	}
+	for i := range spec.InitContainers {
+		if spec.InitContainers[i].Name == name {
+			return &spec.InitContainers[i], nil
+		}
+	}
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == name {
+			return &spec.Containers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("container not found: %s", name)
+}
+
 // Credit to https://github.com/kubernetes/kubectl/blob/e2c59440f3e2c1a58e7012cedcb9b5a7460e279f/pkg/polymorphichelpers/updatepodspec.go#L33
 func updatePodSpecForObject(obj runtime.Object, fn func(*corev1.PodSpec) error) (bool, error) {
 	switch t := obj.(type) {
@@ -0,0 +1,120 @@
+package deploy
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/imagetag"
+	"github.com/iftechio/jki/pkg/project"
+)
+
+// completeProject deploys the image built by `jki build` in the project to deploy targets in the
+// project file. The image is pushed to the first target registry with the tag computed the same
+// way as `jki build`. p is the project found in the working directory, if any.
+func (o *Options) completeProject(f factory.Factory, p *project.Project) error {
+	if p == nil {
+		return fmt.Errorf("no image given and %s is not found", project.FileName)
+	}
+	if len(p.Name) == 0 {
+		return fmt.Errorf("name is not set in %s", p.Path(project.FileName))
+	}
+	if len(p.Deploy) == 0 {
+		return fmt.Errorf("deploy is not set in %s", p.Path(project.FileName))
+	}
+
+	targets, registries, err := f.LoadTargetRegistries()
+	if err != nil {
+		return err
+	}
+	regName := targets[0]
+	if len(p.Registries) != 0 {
+		regName = p.Registries[0]
+	}
+	reg, ok := registries[regName]
+	if !ok {
+		return fmt.Errorf("registry not found: %s", regName)
+	}
+	cfg, err := f.LoadConfig()
+	if err != nil {
+		return err
+	}
+	tag, err := imagetag.Compute(cfg.TagTemplateOf(p.Name))
+	if err != nil {
+		return err
+	}
+	image := fmt.Sprintf("%s/%s:%s", reg.Prefix(), p.Name, tag)
+
+	defaultNamespace, _, err := f.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+	for _, d := range p.Deploy {
+		t := target{
+			namespace: d.Namespace,
+			spec:      d.Resource,
+			container: d.Container,
+			image:     image,
+		}
+		if len(t.namespace) == 0 {
+			t.namespace = defaultNamespace
+		}
+		if len(t.spec) == 0 {
+			t.spec = "deployment.apps/" + p.Name
+		}
+		if len(o.container) != 0 {
+			t.container = o.container
+		}
+		o.targets = append(o.targets, t)
+	}
+	o.newBuilder = f.NewBuilder
+	return nil
+}
+
+// DeployedImage returns the image currently deployed to the first of targets of the image name,
+// which defaults to the deployment with the same name in the default namespace.
+func DeployedImage(f factory.Factory, name string, targets []project.DeployTarget) (string, error) {
+	var t project.DeployTarget
+	if len(targets) != 0 {
+		t = targets[0]
+	}
+	if len(t.Resource) == 0 {
+		t.Resource = "deployment.apps/" + name
+	}
+	if len(t.Namespace) == 0 {
+		var err error
+		t.Namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
+		if err != nil {
+			return "", err
+		}
+	}
+	result := f.NewBuilder().
+		WithScheme(scheme.Scheme, scheme.Scheme.PrioritizedVersionsAllGroups()...).
+		NamespaceParam(t.Namespace).DefaultNamespace().
+		Flatten().
+		ResourceTypeOrNameArgs(false, t.Resource).
+		Latest().
+		Do()
+	infos, err := result.Infos()
+	if err != nil {
+		return "", err
+	}
+	if len(infos) == 0 {
+		return "", fmt.Errorf("%s not found in namespace %s", t.Resource, t.Namespace)
+	}
+	var image string
+	_, err = updatePodSpecForObject(infos[0].Object, func(spec *v1.PodSpec) error {
+		c, err := findContainer(spec, t.Container)
+		if err != nil {
+			return err
+		}
+		image = c.Image
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", t.Resource, err)
+	}
+	return image, nil
+}
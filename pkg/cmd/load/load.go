@@ -0,0 +1,209 @@
+package load
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/iftechio/jki/pkg/bundle"
+	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+type Options struct {
+	dstRegistry *registry.Registry
+	client      *registry.Client
+}
+
+func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
+	dstReg, registries, err := f.LoadRegistries()
+	if err != nil {
+		return err
+	}
+	o.dstRegistry = registries[dstReg]
+	o.client = o.dstRegistry.NewClient()
+	return nil
+}
+
+func (o *Options) Validate(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+	return nil
+}
+
+func (o *Options) Run(args []string) error {
+	ctx := context.TODO()
+	r, err := bundle.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	images, err := r.Images()
+	if err != nil {
+		return err
+	}
+	for _, bi := range images {
+		src := image.FromString(bi.Name)
+		dst := o.dstRegistry.Image(src.Repo, src.Tag)
+		utils.PrintInfo(fmt.Sprintf("Pushing %s", dst.String()))
+		if err := o.dstRegistry.CreateRepoIfNotExists(src.Repo); err != nil {
+			return err
+		}
+		if bi.Desc != nil {
+			err = o.pushOCIImage(ctx, r, dst, *bi.Desc)
+		} else {
+			err = o.pushDockerImage(ctx, r, dst, bi)
+		}
+		if err != nil {
+			return fmt.Errorf("load %s: %s", bi.Name, err)
+		}
+		fmt.Println(dst.String())
+	}
+	utils.PrintInfo("镜像导入成功")
+	return nil
+}
+
+func (o *Options) pushOCIImage(ctx context.Context, r *bundle.Reader, dst image.Image, desc ocispec.Descriptor) error {
+	data, err := o.pushManifestContent(ctx, r, dst.Path(), desc)
+	if err != nil {
+		return err
+	}
+	_, err = o.client.PutManifest(ctx, dst.Path(), dst.Tag, desc.MediaType, data)
+	return err
+}
+
+// pushManifestContent pushes everything referenced by the manifest or index `desc` and
+// returns the raw manifest.
+func (o *Options) pushManifestContent(ctx context.Context, r *bundle.Reader, repo string, desc ocispec.Descriptor) ([]byte, error) {
+	sr, err := r.Blob(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(sr)
+	if err != nil {
+		return nil, err
+	}
+
+	if registry.IsIndex(desc.MediaType) {
+		var index registry.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("decode index: %s", err)
+		}
+		for _, m := range index.Manifests {
+			child, err := o.pushManifestContent(ctx, r, repo, m)
+			if err != nil {
+				return nil, err
+			}
+			_, err = o.client.PutManifest(ctx, repo, m.Digest.String(), m.MediaType, child)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+
+	var manifest registry.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %s", err)
+	}
+	for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		sr, err := r.Blob(blob.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if err := o.pushBlob(ctx, repo, blob, sr); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (o *Options) pushBlob(ctx context.Context, repo string, desc ocispec.Descriptor, r io.Reader) error {
+	exists, err := o.client.BlobExists(ctx, repo, desc.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return o.client.PushBlob(ctx, repo, desc, r)
+}
+
+// pushDockerImage pushes images from docker-archive tarballs, whose layers may be uncompressed.
+func (o *Options) pushDockerImage(ctx context.Context, r *bundle.Reader, dst image.Image, bi bundle.Image) error {
+	repo := dst.Path()
+	sr, err := r.Open(bi.Config)
+	if err != nil {
+		return err
+	}
+	config, err := ioutil.ReadAll(sr)
+	if err != nil {
+		return err
+	}
+	manifest := registry.Manifest{
+		SchemaVersion: 2,
+		MediaType:     registry.MediaTypeDockerManifest,
+		Config: ocispec.Descriptor{
+			MediaType: registry.MediaTypeDockerConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+	}
+	if err := o.pushBlob(ctx, repo, manifest.Config, io.NewSectionReader(sr, 0, sr.Size())); err != nil {
+		return err
+	}
+
+	for _, name := range bi.Layers {
+		layer, err := o.pushDockerLayer(ctx, repo, r, name)
+		if err != nil {
+			return fmt.Errorf("push layer %s: %s", name, err)
+		}
+		manifest.Layers = append(manifest.Layers, layer)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	_, err = o.client.PutManifest(ctx, repo, dst.Tag, manifest.MediaType, data)
+	return err
+}
+
+// pushDockerLayer pushes the layer `name` of docker-archive tarballs, gzipped if it is not.
+func (o *Options) pushDockerLayer(ctx context.Context, repo string, r *bundle.Reader, name string) (ocispec.Descriptor, error) {
+	desc, rc, err := r.Layer(name)
+	if err != nil {
+		return desc, err
+	}
+	defer rc.Close()
+	desc.MediaType = registry.MediaTypeDockerLayer
+	return desc, o.pushBlob(ctx, repo, desc, rc)
+}
+
+func NewCmdLoad(f factory.Factory) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   "load <FILE>",
+		Short: "Load images from a tarball and push them to a registry",
+		Long: `Load images from a tarball created by 'jki save' or 'docker save' and push them
+to the registry specified by --registry, keeping their repositories and tags.`,
+		Example: `  # Push images in bundle.tar to the registry named aws-tokyo
+  jki load bundle.tar --registry aws-tokyo`,
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckError(o.Complete(f, cmd, args))
+			utils.CheckError(o.Validate(args))
+			utils.CheckError(o.Run(args))
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,295 @@
+package outdated
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/iftechio/jki/pkg/dockerfile"
+	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/imagetag"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+type Options struct {
+	dockerFileName string
+	buildArgs      []string
+	workloads      bool
+
+	resolver   *registry.Resolver
+	kubeClient *kubernetes.Clientset
+	namespace  string
+}
+
+func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.resolver, err = f.ToResolver()
+	if err != nil {
+		return err
+	}
+	if !o.workloads {
+		return nil
+	}
+	o.kubeClient, err = f.KubeClient()
+	if err != nil {
+		return err
+	}
+	o.namespace, _, err = f.ToRawKubeConfigLoader().Namespace()
+	return err
+}
+
+func (o *Options) Validate(cmd *cobra.Command) error {
+	if o.workloads && (cmd.Flags().Changed("file") || len(o.buildArgs) != 0) {
+		return fmt.Errorf("--workloads cannot be used with --file or --build-arg")
+	}
+	return nil
+}
+
+// usage is an image and where it is used.
+type usage struct {
+	image string
+	users []string
+}
+
+// report is the latest tags of an image.
+type report struct {
+	usage
+	current   string
+	sameMajor string
+	latest    string
+	// note explains why the image is not compared
+	note string
+}
+
+func (r *report) outdated() bool {
+	return len(r.note) == 0 && r.latest != r.current
+}
+
+// dockerfileImages returns external base images of the Dockerfile.
+func (o *Options) dockerfileImages() ([]usage, error) {
+	f, err := os.Open(o.dockerFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	froms, err := dockerfile.Froms(f, dockerfile.Options{BuildArgs: utils.ConvertKVStringsToMap(o.buildArgs)})
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %s", o.dockerFileName, err)
+	}
+	var usages []usage
+	index := make(map[string]int)
+	for _, from := range froms {
+		if !from.External {
+			continue
+		}
+		user := fmt.Sprintf("line %d", from.StartLine)
+		if len(from.Stage) != 0 {
+			user = fmt.Sprintf("%s (%s)", user, from.Stage)
+		}
+		if i, ok := index[from.Ref]; ok {
+			usages[i].users = append(usages[i].users, user)
+			continue
+		}
+		index[from.Ref] = len(usages)
+		usages = append(usages, usage{image: from.Ref, users: []string{user}})
+	}
+	return usages, nil
+}
+
+// workloadImages returns images of containers of workloads in the namespace.
+func (o *Options) workloadImages(ctx context.Context) ([]usage, error) {
+	type podSpec struct {
+		name string
+		spec *corev1.PodSpec
+	}
+	var specs []podSpec
+	apps := o.kubeClient.AppsV1()
+	deploys, err := apps.Deployments(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range deploys.Items {
+		specs = append(specs, podSpec{"deployment/" + deploys.Items[i].Name, &deploys.Items[i].Spec.Template.Spec})
+	}
+	dss, err := apps.DaemonSets(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range dss.Items {
+		specs = append(specs, podSpec{"daemonset/" + dss.Items[i].Name, &dss.Items[i].Spec.Template.Spec})
+	}
+	stss, err := apps.StatefulSets(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range stss.Items {
+		specs = append(specs, podSpec{"statefulset/" + stss.Items[i].Name, &stss.Items[i].Spec.Template.Spec})
+	}
+	cjs, err := o.kubeClient.BatchV1beta1().CronJobs(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range cjs.Items {
+		specs = append(specs, podSpec{"cronjob/" + cjs.Items[i].Name, &cjs.Items[i].Spec.JobTemplate.Spec.Template.Spec})
+	}
+
+	var usages []usage
+	index := make(map[string]int)
+	for _, s := range specs {
+		containers := append(append([]corev1.Container{}, s.spec.InitContainers...), s.spec.Containers...)
+		for _, c := range containers {
+			user := fmt.Sprintf("%s:%s", s.name, c.Name)
+			if i, ok := index[c.Image]; ok {
+				usages[i].users = append(usages[i].users, user)
+				continue
+			}
+			index[c.Image] = len(usages)
+			usages = append(usages, usage{image: c.Image, users: []string{user}})
+		}
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].image < usages[j].image
+	})
+	return usages, nil
+}
+
+// splitRef splits an image reference into the name, the tag and the digest, which may be empty.
+func splitRef(ref string) (name, tag, digest string) {
+	if i := strings.IndexRune(ref, '@'); i != -1 {
+		ref, digest = ref[:i], ref[i+1:]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref, tag = ref[:i], ref[i+1:]
+	}
+	return ref, tag, digest
+}
+
+// check compares the tag of the image with tags in its repository. tags caches tags of
+// repositories.
+func (o *Options) check(ctx context.Context, u usage, tags map[string][]string) (*report, error) {
+	r := &report{usage: u}
+	_, tag, digest := splitRef(u.image)
+	switch {
+	case len(tag) != 0:
+		r.current = tag
+	case len(digest) != 0:
+		r.current = digest
+		r.note = "pinned to digest without tag"
+		return r, nil
+	default:
+		r.current = "latest"
+	}
+	current, ok := imagetag.ParseVersion(r.current)
+	if !ok {
+		r.note = "tag is not a version or date"
+		return r, nil
+	}
+	img := image.FromString(u.image)
+	repo := img.Host() + "/" + img.Path()
+	repoTags, ok := tags[repo]
+	if !ok {
+		client, err := o.resolver.NewClient(img)
+		if err != nil {
+			return nil, err
+		}
+		repoTags, err = client.ListTags(ctx, img.Path())
+		if err != nil {
+			return nil, fmt.Errorf("list tags of %s: %s", repo, err)
+		}
+		tags[repo] = repoTags
+	}
+	r.sameMajor, r.latest = imagetag.Latest(current, repoTags)
+	if len(r.sameMajor) == 0 {
+		r.sameMajor = "-"
+	}
+	return r, nil
+}
+
+func (o *Options) Run() error {
+	ctx := context.TODO()
+	var (
+		usages []usage
+		err    error
+	)
+	if o.workloads {
+		usages, err = o.workloadImages(ctx)
+	} else {
+		usages, err = o.dockerfileImages()
+	}
+	if err != nil {
+		return err
+	}
+	if len(usages) == 0 {
+		fmt.Println("Found no image to check")
+		return nil
+	}
+
+	tags := make(map[string][]string)
+	var outdated int
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tCURRENT\tLATEST SAME MAJOR\tLATEST\tUSED BY")
+	for _, u := range usages {
+		r, err := o.check(ctx, u, tags)
+		if err != nil {
+			return err
+		}
+		name, _, _ := splitRef(u.image)
+		users := strings.Join(r.users, ", ")
+		if len(r.note) != 0 {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t%s (%s)\n", name, r.current, users, r.note)
+			continue
+		}
+		if r.outdated() {
+			outdated++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, r.current, r.sameMajor, r.latest, users)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	utils.PrintInfo(fmt.Sprintf("%d/%d 个镜像有更新的 tag", outdated, len(usages)))
+	return nil
+}
+
+func NewCmdOutdated(f factory.Factory) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "List newer tags of base images or images of workloads",
+		Long: `List newer tags of base images in a Dockerfile, or images of workloads in a namespace.
+
+Tags are listed through registries in config. Semver tags (1.14, v1.2.3, 3.12-alpine) are only
+compared with tags of the same format and suffix, e.g. 1.14-alpine with 1.15-alpine but not with
+1.15.2-alpine. Date tags (20240101, release-20240101-abc123) are compared by the date. Other
+tags like latest are not compared.`,
+		Example: `  # Check base images of ./Dockerfile
+  jki outdated
+
+  # Check base images of another Dockerfile with build args used in FROM
+  jki outdated -f build/Dockerfile --build-arg GO_VERSION=1.14
+
+  # Check images of deployments, daemonsets, statefulsets and cronjobs in namespace foo
+  jki outdated --workloads -n foo`,
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckError(o.Complete(f, cmd, args))
+			utils.CheckError(o.Validate(cmd))
+			utils.CheckError(o.Run())
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&o.dockerFileName, "file", "f", "Dockerfile", "Name of the Dockerfile")
+	flags.StringSliceVar(&o.buildArgs, "build-arg", nil, "Set build-time variables used in FROM instructions")
+	flags.BoolVar(&o.workloads, "workloads", false, "Check images of workloads in the namespace instead of a Dockerfile")
+	return cmd
+}
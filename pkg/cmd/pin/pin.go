@@ -0,0 +1,194 @@
+package pin
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iftechio/jki/pkg/dockerfile"
+	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+type Options struct {
+	dockerFileName string
+	buildArgs      []string
+	check          bool
+	update         bool
+
+	resolver *registry.Resolver
+}
+
+func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.resolver, err = f.ToResolver()
+	return err
+}
+
+func (o *Options) Validate(args []string) error {
+	if o.check && o.update {
+		return fmt.Errorf("--check cannot be used with --update")
+	}
+	return nil
+}
+
+// pinState is the state of the pin of a base image.
+type pinState string
+
+const (
+	statePinned  pinState = "pinned"
+	stateMissing pinState = "missing"
+	stateStale   pinState = "stale"
+	// stateSkipped is for images given by build args, which cannot be pinned in the Dockerfile
+	stateSkipped pinState = "skipped"
+)
+
+// pin is the state of a base image and its reference pinned to the current digest of the tag.
+type pin struct {
+	state  pinState
+	pinned string
+}
+
+// splitDigest splits the reference written in the Dockerfile into the part before `@` and the
+// digest.
+func splitDigest(ref string) (string, string) {
+	if i := strings.IndexRune(ref, '@'); i != -1 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// resolve looks up the digest of the tag of the base image and works out the state of its pin.
+// Pinned images are only resolved to check whether they are stale with --check or --update.
+func (o *Options) resolve(ctx context.Context, from dockerfile.From) (*pin, error) {
+	p := &pin{}
+	if strings.ContainsRune(from.Original, '$') {
+		p.state = stateSkipped
+		return p, nil
+	}
+	name, current := splitDigest(from.Original)
+	// there is no tag to resolve for image@digest
+	hasTag := strings.ContainsRune(name[strings.LastIndex(name, "/")+1:], ':')
+	if len(current) != 0 && (!hasTag || (!o.check && !o.update)) {
+		p.state = statePinned
+		return p, nil
+	}
+	img := image.FromString(name)
+	client, err := o.resolver.NewClient(img)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := client.HeadManifest(ctx, img.Path(), img.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %s", name, err)
+	}
+	p.pinned = fmt.Sprintf("%s@%s", name, desc.Digest)
+	switch current {
+	case "":
+		p.state = stateMissing
+	case desc.Digest.String():
+		p.state = statePinned
+	default:
+		p.state = stateStale
+	}
+	return p, nil
+}
+
+func (o *Options) Run() error {
+	ctx := context.TODO()
+	data, err := ioutil.ReadFile(o.dockerFileName)
+	if err != nil {
+		return err
+	}
+	opts := dockerfile.Options{BuildArgs: utils.ConvertKVStringsToMap(o.buildArgs)}
+	froms, err := dockerfile.Froms(strings.NewReader(string(data)), opts)
+	if err != nil {
+		return fmt.Errorf("parse %s: %s", o.dockerFileName, err)
+	}
+
+	replace := make(map[string]string)
+	var unpinned int
+	for _, from := range froms {
+		if !from.External {
+			continue
+		}
+		p, err := o.resolve(ctx, from)
+		if err != nil {
+			return err
+		}
+		switch p.state {
+		case stateSkipped:
+			fmt.Printf("skip %s (given by build args)\n", from.Original)
+		case statePinned:
+			fmt.Printf("%s is pinned\n", from.Original)
+		case stateMissing, stateStale:
+			unpinned++
+			fmt.Printf("%s is %s -> %s\n", from.Original, p.state, p.pinned)
+			if p.state == stateMissing || o.update {
+				replace[from.Ref] = p.pinned
+			}
+		}
+	}
+	if o.check {
+		if unpinned != 0 {
+			return fmt.Errorf("%d base images of %s are not pinned or stale, run `jki pin --update` to fix", unpinned, o.dockerFileName)
+		}
+		return nil
+	}
+	if len(replace) == 0 {
+		utils.PrintInfo("所有基础镜像都已经锁定")
+		return nil
+	}
+	data, err = dockerfile.Rewrite(data, opts, replace)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(o.dockerFileName)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(o.dockerFileName, data, fi.Mode()); err != nil {
+		return err
+	}
+	utils.PrintInfo(fmt.Sprintf("已锁定 %d 个基础镜像: %s", len(replace), o.dockerFileName))
+	return nil
+}
+
+func NewCmdPin(f factory.Factory) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   "pin",
+		Short: "Pin base images of a Dockerfile to digests",
+		Long: `Pin base images of a Dockerfile to digests.
+
+Base images in FROM instructions are resolved through registries in config and rewritten
+from image:tag to image:tag@sha256:... Existing pins are kept unless --update is set.
+Base images given by build args are skipped.`,
+		Example: `  # Pin unpinned base images
+  jki pin
+
+  # Fail if any base image is not pinned or its tag has moved, e.g. in CI
+  jki pin --check
+
+  # Refresh all pins to the current digests of the tags
+  jki pin --update -f build/Dockerfile`,
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckError(o.Complete(f, cmd, args))
+			utils.CheckError(o.Validate(args))
+			utils.CheckError(o.Run())
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&o.dockerFileName, "file", "f", "Dockerfile", "Name of the Dockerfile")
+	flags.StringSliceVar(&o.buildArgs, "build-arg", nil, "Set build-time variables used in FROM instructions")
+	flags.BoolVar(&o.check, "check", false, "Do not write the Dockerfile, exit with error if pins are missing or stale")
+	flags.BoolVar(&o.update, "update", false, "Refresh existing pins to the current digests of the tags")
+	return cmd
+}
@@ -0,0 +1,85 @@
+package pin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/iftechio/jki/pkg/dockerfile"
+	"github.com/iftechio/jki/pkg/registry"
+)
+
+func TestSplitDigest(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		ref    string
+		name   string
+		digest string
+	}{
+		{ref: "alpine", name: "alpine"},
+		{ref: "alpine:3.12", name: "alpine:3.12"},
+		{ref: "alpine:3.12@sha256:abc", name: "alpine:3.12", digest: "sha256:abc"},
+		{ref: "localhost:5000/ns/app@sha256:abc", name: "localhost:5000/ns/app", digest: "sha256:abc"},
+	}
+	for _, tC := range testCases {
+		name, dgst := splitDigest(tC.ref)
+		if name != tC.name || dgst != tC.digest {
+			t.Errorf("%s: expected: %q %q, got: %q %q", tC.ref, tC.name, tC.digest, name, dgst)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Parallel()
+	current := digest.FromString("v1")
+	old := digest.FromString("old")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/v2/ns/app/manifests/v1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", registry.MediaTypeDockerManifest)
+		w.Header().Set("Docker-Content-Digest", current.String())
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	app := host + "/ns/app:v1"
+
+	testCases := []struct {
+		name     string
+		original string
+		check    bool
+		update   bool
+		expected pin
+		err      bool
+	}{
+		{name: "build arg", original: "$BASE", expected: pin{state: stateSkipped}},
+		{name: "missing", original: app, expected: pin{state: stateMissing, pinned: app + "@" + current.String()}},
+		{name: "pinned not resolved", original: app + "@" + old.String(), expected: pin{state: statePinned}},
+		{name: "digest only", original: host + "/ns/app@" + old.String(), check: true, expected: pin{state: statePinned}},
+		{name: "pinned", original: app + "@" + current.String(), check: true, expected: pin{state: statePinned, pinned: app + "@" + current.String()}},
+		{name: "stale", original: app + "@" + old.String(), update: true, expected: pin{state: stateStale, pinned: app + "@" + current.String()}},
+		{name: "not found", original: host + "/ns/app:v2", err: true},
+	}
+	for _, tC := range testCases {
+		o := &Options{check: tC.check, update: tC.update, resolver: &registry.Resolver{}}
+		p, err := o.resolve(context.Background(), dockerfile.From{Original: tC.original})
+		if tC.err {
+			if err == nil {
+				t.Errorf("%s: expected error", tC.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tC.name, err)
+			continue
+		}
+		if *p != tC.expected {
+			t.Errorf("%s: expected: %+v, got: %+v", tC.name, tC.expected, *p)
+		}
+	}
+}
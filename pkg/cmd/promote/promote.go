@@ -0,0 +1,150 @@
+package promote
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+type Options struct {
+	resolver *registry.Resolver
+
+	src image.Image
+	dst image.Image
+}
+
+func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+	var err error
+	o.resolver, err = f.ToResolver()
+	if err != nil {
+		return err
+	}
+	o.src = image.FromString(args[0])
+	o.dst = parseTarget(o.src, args[1])
+	return nil
+}
+
+// parseTarget parses the target of promotion, which can be
+//
+//	TAG:            a new tag in the same repository, a bare name is always a tag
+//	REPO:TAG:       a new repository in the same namespace, the tag is kept if empty
+//	HOST/REPO:TAG:  a full image reference
+func parseTarget(src image.Image, target string) image.Image {
+	dst := src
+	dst.Digest = ""
+	switch {
+	case strings.ContainsRune(target, '/'):
+		dst = image.FromString(target)
+	case strings.ContainsRune(target, ':'):
+		parts := strings.SplitN(target, ":", 2)
+		dst.Repo = parts[0]
+		if len(parts[1]) != 0 {
+			dst.Tag = parts[1]
+		}
+	default:
+		dst.Tag = target
+	}
+	return dst
+}
+
+func (o *Options) Validate(args []string) error {
+	if o.src.Host() != o.dst.Host() {
+		return fmt.Errorf("cannot promote across registries (%s -> %s), use `jki cp` instead", o.src.Host(), o.dst.Host())
+	}
+	if len(o.dst.Digest) != 0 || len(o.dst.Tag) == 0 {
+		return fmt.Errorf("target must be tagged, not a digest: %s", args[1])
+	}
+	if o.src.String() == o.dst.String() {
+		return fmt.Errorf("source and target are the same: %s", o.src.String())
+	}
+	return nil
+}
+
+func (o *Options) Run() error {
+	ctx := context.TODO()
+	srcReg, err := o.resolver.ResolveRegistryByImage(o.src.String())
+	if err != nil {
+		return err
+	}
+	srcClient := registry.NewClient(srcReg, o.src.Host())
+	// the target may be another namespace with its own credentials
+	dstReg, err := o.resolver.ResolveRegistryByImage(o.dst.String())
+	if err != nil {
+		return err
+	}
+	dstClient := registry.NewClient(dstReg, o.dst.Host())
+	raw, desc, err := srcClient.GetManifest(ctx, o.src.Path(), o.src.Reference())
+	if err != nil {
+		return fmt.Errorf("resolve %s: %s", o.src.String(), err)
+	}
+
+	if o.dst.Repo != o.src.Repo {
+		if err := dstReg.CreateRepoIfNotExists(o.dst.Repo); err != nil {
+			return err
+		}
+	}
+	err = registry.CopyManifest(ctx, srcClient, o.src.Path(), dstClient, o.dst.Path(), desc, raw, o.dst.Tag)
+	if err != nil {
+		return err
+	}
+
+	dstDesc, err := dstClient.HeadManifest(ctx, o.dst.Path(), o.dst.Tag)
+	if err != nil {
+		return fmt.Errorf("verify %s: %s", o.dst.String(), err)
+	}
+	if dstDesc.Digest != desc.Digest {
+		return fmt.Errorf("digest mismatch after promotion: source %s, target %s", desc.Digest, dstDesc.Digest)
+	}
+
+	fmt.Printf("%s@%s\n", o.dst.String(), dstDesc.Digest)
+	_ = utils.SetClipboard(o.dst.String())
+	utils.PrintInfo("镜像地址已复制到粘贴板")
+	return nil
+}
+
+func NewCmdPromote(f factory.Factory) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   "promote <IMAGE> <TAG|REPO:[TAG]|IMAGE:TAG>",
+		Short: "Retag an image inside a registry without pulling it",
+		Long: `Retag an image inside a registry without pulling it.
+
+Only manifests are uploaded. Blobs are mounted from the source repository when the
+target is another repository on the same registry, so no docker daemon is needed.
+
+The target is one of:
+  TAG           a new tag in the same repository
+  REPO:[TAG]    a repository in the same namespace, the tag is kept if TAG is empty
+  IMAGE:TAG     a full image reference on the same registry, digests are not allowed
+
+A bare name is always taken as a tag, so a new repository needs the trailing colon,
+e.g. "app-prod:".`,
+		Example: `  # Tag registry.cn-hangzhou.aliyuncs.com/foo/app:master-abc123 as release-1.4
+  jki promote registry.cn-hangzhou.aliyuncs.com/foo/app:master-abc123 release-1.4
+
+  # Promote to the repository app-prod with the same tag (note the trailing colon)
+  jki promote registry.cn-hangzhou.aliyuncs.com/foo/app:master-abc123 app-prod:
+
+  # Promote to the repository app-prod as release-1.4
+  jki promote registry.cn-hangzhou.aliyuncs.com/foo/app:master-abc123 app-prod:release-1.4
+
+  # Promote to another namespace of the same registry
+  jki promote registry.cn-hangzhou.aliyuncs.com/foo/app:master-abc123 registry.cn-hangzhou.aliyuncs.com/bar/app:release-1.4`,
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckError(o.Complete(f, cmd, args))
+			utils.CheckError(o.Validate(args))
+			utils.CheckError(o.Run())
+		},
+	}
+	return cmd
+}
@@ -7,11 +7,10 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/jsonmessage"
-	"github.com/docker/docker/pkg/term"
 	"github.com/spf13/cobra"
 
 	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/progress"
 	"github.com/iftechio/jki/pkg/registry"
 	"github.com/iftechio/jki/pkg/utils"
 )
@@ -21,6 +20,8 @@ type Options struct {
 	dockerClient *client.Client
 	imageRef     string
 	platform     string
+	progress     progress.Mode
+	timings      *progress.Timings
 }
 
 func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
@@ -37,6 +38,11 @@ func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string)
 
 	o.imageRef = args[0]
 	o.platform = f.Platform()
+	o.progress, err = f.Progress()
+	if err != nil {
+		return err
+	}
+	o.timings = f.Timings()
 	return nil
 }
 
@@ -49,7 +55,6 @@ func (o *Options) Validate(args []string) error {
 
 func (o *Options) Run() error {
 	ctx := context.Background()
-	termFd, isTerm := term.GetFdInfo(os.Stdout)
 
 	_, _, err := o.dockerClient.ImageInspectWithRaw(ctx, o.imageRef)
 	if err == nil {
@@ -70,7 +75,7 @@ func (o *Options) Run() error {
 	if err != nil {
 		return err
 	}
-	err = jsonmessage.DisplayJSONMessagesStream(out, os.Stdout, termFd, isTerm, nil)
+	err = progress.DisplayJSONMessages(out, o.progress, os.Stdout, o.timings, nil)
 	if err != nil {
 		return err
 	}
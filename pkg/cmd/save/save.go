@@ -0,0 +1,192 @@
+package save
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+
+	"github.com/iftechio/jki/pkg/bundle"
+	"github.com/iftechio/jki/pkg/factory"
+	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/registry"
+	"github.com/iftechio/jki/pkg/utils"
+)
+
+type Options struct {
+	output       string
+	allPlatforms bool
+
+	resolver *registry.Resolver
+	platform string
+}
+
+func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+	o.resolver, err = f.ToResolver()
+	if err != nil {
+		return err
+	}
+	o.platform = f.Platform()
+	return nil
+}
+
+func (o *Options) Validate(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("wrong number of arguments")
+	}
+	if len(o.output) == 0 {
+		return fmt.Errorf("output file must be specified")
+	}
+	return nil
+}
+
+func (o *Options) Run(args []string) error {
+	ctx := context.TODO()
+	f, err := os.Create(o.output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bundle.NewWriter(f)
+	for _, ref := range args {
+		utils.PrintInfo(fmt.Sprintf("Saving %s", ref))
+		if err := o.saveImage(ctx, w, ref); err != nil {
+			return fmt.Errorf("save %s: %s", ref, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	utils.PrintInfo(fmt.Sprintf("%d image(s) saved to %s", len(args), o.output))
+	return nil
+}
+
+func (o *Options) saveImage(ctx context.Context, w *bundle.Writer, ref string) error {
+	img := image.FromString(ref)
+	client, err := o.resolver.NewClient(img)
+	if err != nil {
+		return err
+	}
+	repo := img.Path()
+	data, desc, err := client.GetManifest(ctx, repo, img.Reference())
+	if err != nil {
+		return err
+	}
+
+	name := img.String()
+	tagged := img
+	tagged.Digest = ""
+	if registry.IsIndex(desc.MediaType) {
+		var index registry.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("decode index: %s", err)
+		}
+		want := image.ParsePlatform(o.platform)
+		if o.allPlatforms {
+			// docker load takes one image per tag, which is the one of --platform
+			var docker *registry.Manifest
+			for _, m := range index.Manifests {
+				manifest, err := saveManifest(ctx, w, client, repo, m, nil)
+				if err != nil {
+					return err
+				}
+				if docker == nil && image.MatchPlatform(m.Platform, want) {
+					docker = manifest
+				}
+			}
+			if err := w.WriteBlob(desc, bytes.NewReader(data)); err != nil {
+				return err
+			}
+			w.AddImage(name, img.Tag, desc)
+			if docker == nil {
+				_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s has no manifest for platform %s, it can only be loaded by 'jki load'\n", ref, image.FormatPlatform(want))
+				return nil
+			}
+			w.AddDockerImage(tagged.String(), docker.Config, docker.Layers)
+			return nil
+		}
+
+		found := false
+		for _, m := range index.Manifests {
+			if image.MatchPlatform(m.Platform, want) {
+				desc, data, found = m, nil, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("no manifest found for platform %s", image.FormatPlatform(want))
+		}
+	}
+
+	manifest, err := saveManifest(ctx, w, client, repo, desc, data)
+	if err != nil {
+		return err
+	}
+	w.AddImage(name, img.Tag, desc)
+	w.AddDockerImage(tagged.String(), manifest.Config, manifest.Layers)
+	return nil
+}
+
+// saveManifest writes the manifest `desc` and its blobs. The manifest is fetched if data is nil.
+func saveManifest(ctx context.Context, w *bundle.Writer, client *registry.Client, repo string, desc ocispec.Descriptor, data []byte) (*registry.Manifest, error) {
+	if data == nil {
+		var err error
+		data, _, err = client.GetManifest(ctx, repo, desc.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+	}
+	var manifest registry.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %s", err)
+	}
+	for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		if w.HasBlob(blob.Digest) {
+			continue
+		}
+		rc, err := client.GetBlob(ctx, repo, blob.Digest)
+		if err != nil {
+			return nil, err
+		}
+		err = w.WriteBlob(blob, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := w.WriteBlob(desc, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func NewCmdSave(f factory.Factory) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   "save <IMAGE...> -o <FILE>",
+		Short: "Save images from registries to a tarball",
+		Long: `Save images from registries to a tarball without a docker daemon.
+
+The tarball is an OCI image layout and can be loaded by both 'jki load' and 'docker load'.
+With --all-platforms, 'jki load' pushes all platforms of multi-arch images, while 'docker load'
+loads the platform specified by --platform.`,
+		Example: `  # Save two images to bundle.tar
+  jki save nginx:alpine registry.cn-hangzhou.aliyuncs.com/foo/bar:v1 -o bundle.tar`,
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckError(o.Complete(f, cmd, args))
+			utils.CheckError(o.Validate(args))
+			utils.CheckError(o.Run(args))
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVarP(&o.output, "output", "o", "", "Write to a file")
+	flags.BoolVar(&o.allPlatforms, "all-platforms", false, "Save all platforms of multi-arch images instead of the one specified by --platform")
+	return cmd
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/iftechio/jki/pkg/cmd/cp"
 	"github.com/iftechio/jki/pkg/factory"
 	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/notify"
 	"github.com/iftechio/jki/pkg/registry"
 	"github.com/iftechio/jki/pkg/utils"
 
@@ -39,6 +40,8 @@ type transferImageOptions struct {
 	kubeClient  *kubernetes.Clientset
 	cp          *cp.Options
 	dstRegistry *registry.Registry
+	notifier    *notify.Notifier
+	cluster     string
 }
 
 func (o *transferImageOptions) Complete(f factory.Factory) error {
@@ -56,6 +59,15 @@ func (o *transferImageOptions) Complete(f factory.Factory) error {
 	if err != nil {
 		return err
 	}
+	cfg, err := f.LoadConfig()
+	if err != nil {
+		return err
+	}
+	o.notifier, err = notify.New(cfg.Notifications)
+	if err != nil {
+		return err
+	}
+	o.cluster = f.Cluster()
 	return o.cp.Complete(f, nil, nil)
 }
 
@@ -63,7 +75,10 @@ func newTransferImageOptions() *transferImageOptions {
 	return &transferImageOptions{}
 }
 
-func (o *transferImageOptions) fixPodSpec(podSpec *apiv1.PodTemplateSpec, it brokenObject, domain string) {
+// fixPodSpec copies the broken image to the accessable registry and replaces it in podSpec. The new
+// image is returned.
+func (o *transferImageOptions) fixPodSpec(podSpec *apiv1.PodTemplateSpec, it brokenObject, domain string) string {
+	var newImage string
 	for i, con := range podSpec.Spec.Containers {
 		if con.Image == it.Image {
 			// copy to accessable registry
@@ -74,8 +89,20 @@ func (o *transferImageOptions) fixPodSpec(podSpec *apiv1.PodTemplateSpec, it bro
 			img.Domain = domain
 			podSpec.Spec.Containers[i].Image = img.String()
 			fmt.Printf("Transfered %s to %s\n", it.Image, img.String())
+			newImage = img.String()
 		}
 	}
+	return newImage
+}
+
+// notifyFixed sends transferimage.fixed of the workload to webhooks in config.
+func (o *transferImageOptions) notifyFixed(it brokenObject, newImage string) {
+	ev := notify.NewEvent(notify.TransferImage, newImage)
+	ev.Source = it.Image
+	ev.Cluster = o.cluster
+	ev.Namespace = o.namespace
+	ev.Workload = strings.ToLower(it.Kind) + "/" + it.Name
+	o.notifier.Notify(ev)
 }
 
 func (o *transferImageOptions) Run() (err error) {
@@ -147,31 +174,34 @@ func (o *transferImageOptions) Run() (err error) {
 				if err != nil {
 					return err
 				}
-				o.fixPodSpec(&deploy.Spec.Template, it, o.dstRegistry.Prefix())
+				newImage := o.fixPodSpec(&deploy.Spec.Template, it, o.dstRegistry.Prefix())
 				_, err = deploymentClient.Update(ctx, deploy, metav1.UpdateOptions{})
 				if err != nil {
 					return err
 				}
+				o.notifyFixed(it, newImage)
 			case "DaemonSet":
 				ds, err := dsClient.Get(ctx, it.Name, metav1.GetOptions{})
 				if err != nil {
 					return err
 				}
-				o.fixPodSpec(&ds.Spec.Template, it, o.dstRegistry.Prefix())
+				newImage := o.fixPodSpec(&ds.Spec.Template, it, o.dstRegistry.Prefix())
 				_, err = dsClient.Update(ctx, ds, metav1.UpdateOptions{})
 				if err != nil {
 					return err
 				}
+				o.notifyFixed(it, newImage)
 			case "StatefulSet":
 				sts, err := stsClient.Get(ctx, it.Name, metav1.GetOptions{})
 				if err != nil {
 					return err
 				}
-				o.fixPodSpec(&sts.Spec.Template, it, o.dstRegistry.Prefix())
+				newImage := o.fixPodSpec(&sts.Spec.Template, it, o.dstRegistry.Prefix())
 				_, err = stsClient.Update(ctx, sts, metav1.UpdateOptions{})
 				if err != nil {
 					return err
 				}
+				o.notifyFixed(it, newImage)
 			}
 		}
 	}
@@ -13,10 +13,12 @@ import (
 	"strings"
 	"time"
 
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/spf13/cobra"
 
 	"github.com/iftechio/jki/pkg/factory"
 	"github.com/iftechio/jki/pkg/info"
+	"github.com/iftechio/jki/pkg/progress"
 	"github.com/iftechio/jki/pkg/utils"
 )
 
@@ -39,6 +41,8 @@ type Options struct {
 
 	client   *http.Client
 	selfPath string
+	progress progress.Mode
+	timings  *progress.Timings
 }
 
 func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string) error {
@@ -61,6 +65,11 @@ func (o *Options) Complete(f factory.Factory, cmd *cobra.Command, args []string)
 		return err
 	}
 	o.selfPath = myPath
+	o.progress, err = f.Progress()
+	if err != nil {
+		return err
+	}
+	o.timings = f.Timings()
 	return nil
 }
 
@@ -86,10 +95,41 @@ func getLatestRelease(client *http.Client, url string) (*releaseResponse, error)
 	return body, nil
 }
 
-func writeWithProgress(total int64, dst io.Writer, src io.Reader) error {
+// reportProgress prints the progress of downloading name. Plain and JSON progress are reported
+// every 10 percent. Nothing is reported if the size is unknown.
+func reportProgress(mode progress.Mode, name string, written, total int64, reported *int64) {
+	if total <= 0 {
+		return
+	}
+	percent := written * 100 / total
+	switch mode {
+	case progress.TTY:
+		fmt.Printf("\033[2K\rProgress: %.2f%%", float64(written)*100/float64(total))
+		return
+	case progress.JSON:
+		if percent/10 == *reported/10 && written != total {
+			return
+		}
+		_ = json.NewEncoder(os.Stdout).Encode(jsonmessage.JSONMessage{
+			ID:       name,
+			Status:   "Downloading",
+			Progress: &jsonmessage.JSONProgress{Current: written, Total: total},
+			TimeNano: time.Now().UnixNano(),
+		})
+	default:
+		if percent/10 == *reported/10 && written != total {
+			return
+		}
+		fmt.Printf("%sProgress: %d%%\n", progress.Timestamp(time.Now()), percent)
+	}
+	*reported = percent
+}
+
+func writeWithProgress(mode progress.Mode, name string, total int64, dst io.Writer, src io.Reader) error {
 	var (
-		err     error
-		written int64
+		err      error
+		written  int64
+		reported int64
 	)
 	buf := make([]byte, 32*1024)
 	for {
@@ -98,7 +138,7 @@ func writeWithProgress(total int64, dst io.Writer, src io.Reader) error {
 			nw, ew := dst.Write(buf[0:nr])
 			if nw > 0 {
 				written += int64(nw)
-				fmt.Printf("\033[2K\rProgress: %.2f%%", float64(written)*100/float64(total))
+				reportProgress(mode, name, written, total, &reported)
 			}
 			if ew != nil {
 				err = ew
@@ -122,7 +162,7 @@ func writeWithProgress(total int64, dst io.Writer, src io.Reader) error {
 	return err
 }
 
-func downloadAsset(client *http.Client, asset releaseAsset) (string, error) {
+func downloadAsset(client *http.Client, asset releaseAsset, mode progress.Mode) (string, error) {
 	fp := filepath.Join(os.TempDir(), asset.Name)
 	fi, err := os.Stat(fp)
 	if err == nil && fi.Size() == asset.Size {
@@ -143,11 +183,14 @@ func downloadAsset(client *http.Client, asset releaseAsset) (string, error) {
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("download asset: unexpected status: %d", resp.StatusCode)
 	}
-	err = writeWithProgress(asset.Size, f, resp.Body)
+	err = writeWithProgress(mode, asset.Name, asset.Size, f, resp.Body)
 	if err != nil {
 		return "", err
 	}
-	fmt.Printf("\nAsset has been saved at %s\n", fp)
+	if mode == progress.TTY {
+		fmt.Println()
+	}
+	fmt.Printf("Asset has been saved at %s\n", fp)
 	return fp, err
 }
 
@@ -221,10 +264,14 @@ func (o *Options) Run() error {
 				return nil
 			}
 		}
-		fp, err := downloadAsset(o.client, asset)
+		started := time.Now()
+		fp, err := downloadAsset(o.client, asset, o.progress.Resolve(os.Stdout))
 		if err != nil {
 			return err
 		}
+		if o.timings != nil {
+			o.timings.Add("download "+asset.Name, started, time.Now())
+		}
 		err = extractAsset(fp)
 		if err != nil {
 			return err
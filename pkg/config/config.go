@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	units "github.com/docker/go-units"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultContextSizeWarning is the default of ContextSizeWarning.
+const DefaultContextSizeWarning = "500MB"
+
+// Config holds settings in the config file other than registries, which are loaded by
+// registry.LoadRegistries.
+type Config struct {
+	// PushTo lists the registries built images are pushed to. Defaults to `default-registry`.
+	PushTo []string `json:"push-to"`
+	// TagTemplate computes tags of built images, see `jki build -h`.
+	TagTemplate string `json:"tag-template"`
+	// ProvenanceLabels adds org.opencontainers.image.* labels to built images. Defaults to true.
+	ProvenanceLabels *bool `json:"provenance-labels"`
+	// Labels are added to all built images.
+	Labels map[string]string `json:"labels"`
+	// ContextSizeWarning is the size of build contexts over which jki build warns, e.g. 1GB.
+	// Defaults to DefaultContextSizeWarning, 0 disables the warning.
+	ContextSizeWarning string `json:"context-size-warning"`
+	// Projects holds per project settings keyed by image name.
+	Projects map[string]Project `json:"projects"`
+	// Notifications are webhooks notified of events of build, cp, deploy and transferimage.
+	Notifications []Notification `json:"notifications"`
+	// Hooks are shell commands run before and after build, push, cp and deploy.
+	Hooks Hooks `json:"hooks"`
+}
+
+// Hooks are shell commands run before and after operations of jki commands.
+type Hooks struct {
+	Build  Hook `json:"build"`
+	Push   Hook `json:"push"`
+	Cp     Hook `json:"cp"`
+	Deploy Hook `json:"deploy"`
+}
+
+// Hook holds commands run before and after an operation. A pre command exiting with non-zero
+// status aborts the operation.
+type Hook struct {
+	Pre  []string `json:"pre"`
+	Post []string `json:"post"`
+}
+
+// Empty reports whether no hook is set.
+func (h Hooks) Empty() bool {
+	for _, hook := range []Hook{h.Build, h.Push, h.Cp, h.Deploy} {
+		if len(hook.Pre) != 0 || len(hook.Post) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Notification is a webhook notified of events of jki commands.
+type Notification struct {
+	// Type is the format of requests: webhook (default), slack, dingtalk, lark or wecom.
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Secret signs requests to dingtalk and lark robots with signature verification enabled.
+	Secret string `json:"secret"`
+	// Events are patterns of names of events to send, e.g. build.* or *.failure. Defaults to all.
+	Events []string `json:"events"`
+	// Headers are added to requests, e.g. Authorization of generic webhooks.
+	Headers map[string]string `json:"headers"`
+}
+
+// Project holds settings of the project building the image of the same name.
+type Project struct {
+	// TagTemplate overrides the global tag template.
+	TagTemplate string `json:"tag-template"`
+	// Secrets are exposed to `RUN --mount=type=secret` of the build.
+	Secrets []Secret `json:"secrets"`
+	// MaxSize is the size budget of the image, e.g. 300MB, checked by jki build against the
+	// uncompressed size of the image in the docker daemon before it is pushed, as shown by
+	// `docker images`. Images built by --builder or exported by --output are not checked.
+	MaxSize string `json:"max-size"`
+	// MaxLayerSize is the size budget of a single uncompressed layer of the image.
+	MaxLayerSize string `json:"max-layer-size"`
+	// SizeCheck is what jki build does when a budget is exceeded, fail (default) or warn.
+	SizeCheck string `json:"size-check"`
+}
+
+// SizeBudget is the size budget of an image in bytes. Zero means no budget.
+type SizeBudget struct {
+	Image int64
+	Layer int64
+	// Warn is set if exceeding the budget only prints a warning.
+	Warn bool
+}
+
+// IsSet reports whether there is a budget.
+func (b SizeBudget) IsSet() bool {
+	return b.Image > 0 || b.Layer > 0
+}
+
+// Secret is a build secret read from a file or an environment variable.
+type Secret struct {
+	ID  string `json:"id"`
+	Src string `json:"src"`
+	Env string `json:"env"`
+}
+
+// Load reads the config file. An empty config is returned if the file does not exist.
+func Load(configPath string) (*Config, error) {
+	var cfg Config
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &cfg, nil
+		}
+		return nil, err
+	}
+	err = yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("decode yaml: %s", err)
+	}
+	return &cfg, nil
+}
+
+// Project returns settings of the project name.
+func (c *Config) Project(name string) Project {
+	return c.Projects[name]
+}
+
+// TagTemplateOf returns the tag template of the project name.
+func (c *Config) TagTemplateOf(name string) string {
+	if t := c.Project(name).TagTemplate; len(t) != 0 {
+		return t
+	}
+	return c.TagTemplate
+}
+
+// SizeBudgetOf returns the size budget of the project name.
+func (c *Config) SizeBudgetOf(name string) (SizeBudget, error) {
+	p := c.Project(name)
+	var budget SizeBudget
+	for _, s := range []struct {
+		field string
+		value string
+		size  *int64
+	}{
+		{"max-size", p.MaxSize, &budget.Image},
+		{"max-layer-size", p.MaxLayerSize, &budget.Layer},
+	} {
+		if len(s.value) == 0 {
+			continue
+		}
+		size, err := units.FromHumanSize(s.value)
+		if err != nil {
+			return budget, fmt.Errorf("invalid %s of %s: %s", s.field, name, err)
+		}
+		*s.size = size
+	}
+	switch p.SizeCheck {
+	case "", "fail":
+	case "warn":
+		budget.Warn = true
+	default:
+		return budget, fmt.Errorf("invalid size-check of %s: %s, expected fail or warn", name, p.SizeCheck)
+	}
+	return budget, nil
+}
+
+// ContextSizeLimit returns ContextSizeWarning in bytes.
+func (c *Config) ContextSizeLimit() (int64, error) {
+	s := c.ContextSizeWarning
+	if len(s) == 0 {
+		s = DefaultContextSizeWarning
+	}
+	size, err := units.FromHumanSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid context-size-warning: %s", err)
+	}
+	return size, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/spf13/pflag"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -13,6 +14,8 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/iftechio/jki/pkg/config"
+	"github.com/iftechio/jki/pkg/progress"
 	"github.com/iftechio/jki/pkg/registry"
 	"github.com/iftechio/jki/pkg/utils"
 )
@@ -23,6 +26,9 @@ type ConfigFlags struct {
 	platform    string
 	kubeconfig  string
 	namespace   string
+	progress    string
+	summary     bool
+	timings     *progress.Timings
 	konfigFlags *genericclioptions.ConfigFlags
 }
 
@@ -49,6 +55,19 @@ func (f *ConfigFlags) ToRawKubeConfigLoader() clientcmd.ClientConfig {
 	return f.konfigFlags.ToRawKubeConfigLoader()
 }
 
+// Cluster returns the name of the kubeconfig context in use, which is --context or the current
+// context. It is empty if kubeconfig cannot be loaded.
+func (f *ConfigFlags) Cluster() string {
+	if f.konfigFlags.Context != nil && len(*f.konfigFlags.Context) != 0 {
+		return *f.konfigFlags.Context
+	}
+	raw, err := f.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
+}
+
 func (f *ConfigFlags) ToResolver() (*registry.Resolver, error) {
 	return registry.NewResolver(f.configPath)
 }
@@ -64,6 +83,37 @@ func (f *ConfigFlags) LoadRegistries() (defReg string, registries map[string]*re
 	return
 }
 
+// LoadTargetRegistries returns names of registries to push images to. They are taken from
+// --registry (comma separated), then `push-to` and `default-registry` in config.
+func (f *ConfigFlags) LoadTargetRegistries() (targets []string, registries map[string]*registry.Registry, err error) {
+	defReg, registries, err := registry.LoadRegistries(f.configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(f.registry) != 0 {
+		targets = strings.Split(f.registry, ",")
+	} else {
+		cfg, err := f.LoadConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		targets = cfg.PushTo
+	}
+	if len(targets) == 0 {
+		targets = []string{defReg}
+	}
+	for _, name := range targets {
+		if _, exist := registries[name]; !exist {
+			return nil, nil, fmt.Errorf("registry not found: %s", name)
+		}
+	}
+	return targets, registries, nil
+}
+
+func (f *ConfigFlags) LoadConfig() (*config.Config, error) {
+	return config.Load(f.configPath)
+}
+
 func (f *ConfigFlags) KubeClient() (*kubernetes.Clientset, error) {
 	config, err := f.ToRESTConfig()
 	if err != nil {
@@ -76,6 +126,22 @@ func (f *ConfigFlags) KubeClient() (*kubernetes.Clientset, error) {
 	return clientset, nil
 }
 
+// Progress returns the mode of --progress.
+func (f *ConfigFlags) Progress() (progress.Mode, error) {
+	return progress.ParseMode(f.progress)
+}
+
+// Timings returns timings of steps printed at exit with --progress-summary, or nil without it.
+func (f *ConfigFlags) Timings() *progress.Timings {
+	if !f.summary {
+		return nil
+	}
+	if f.timings == nil {
+		f.timings = progress.NewTimings()
+	}
+	return f.timings
+}
+
 func (f *ConfigFlags) ConfigPath() string {
 	return f.configPath
 }
@@ -83,10 +149,12 @@ func (f *ConfigFlags) ConfigPath() string {
 func (f *ConfigFlags) AddFlags(flags *pflag.FlagSet) {
 	homedir := utils.HomeDir()
 	flags.StringVar(&f.configPath, "jkiconfig", filepath.Join(homedir, ".jki.yaml"), "Config path")
-	flags.StringVarP(&f.registry, "registry", "r", "", "The desired registry. If not set, use the `default-registry` in config.")
+	flags.StringVarP(&f.registry, "registry", "r", "", "The desired registry. If not set, use the `default-registry` in config. The build command accepts a comma separated list.")
 	flags.StringVarP(&f.platform, "platform", "p", "", fmt.Sprintf("The desired platform. (default \"%s\")", runtime.GOARCH))
 	flags.StringVar(f.konfigFlags.KubeConfig, "kubeconfig", filepath.Join(homedir, ".kube", "config"), "The path to kubeconfig. If not set `~/.kube/config` will be used")
 	flags.StringVarP(f.konfigFlags.Namespace, "namespace", "n", "", "If present, the namespace scope for this CLI request")
+	flags.StringVar(&f.progress, "progress", string(progress.Auto), "Set type of progress output of build, cp, pull and upgrade: auto, tty, plain or json")
+	flags.BoolVar(&f.summary, "progress-summary", false, "Print durations of steps at exit")
 }
 
 func New() *ConfigFlags {
@@ -0,0 +1,205 @@
+// Package dockerfile extracts base images from Dockerfiles with the parser of the buildkit
+// dockerfile frontend, so that they are resolved the same way as in builds.
+package dockerfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/moby/buildkit/frontend/dockerfile/instructions"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+	"github.com/moby/buildkit/frontend/dockerfile/shell"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	imageutil "github.com/iftechio/jki/pkg/image"
+)
+
+// scratch is the empty image, which is not pulled.
+const scratch = "scratch"
+
+// BaseImage is an external image in a FROM instruction.
+type BaseImage struct {
+	// Ref is the reference with build args expanded.
+	Ref string
+	// Platform is the expanded --platform of the stage, empty if not set.
+	Platform string
+}
+
+// Options are build options affecting base images.
+type Options struct {
+	// BuildArgs override defaults of ARG instructions before the first FROM.
+	BuildArgs map[string]string
+	// TargetPlatform is the platform built for, e.g. linux/arm64 or arm64. Defaults to the
+	// platform jki runs on.
+	TargetPlatform string
+}
+
+// platformArgs returns automatic platform ARGs of buildkit, e.g. TARGETPLATFORM.
+func platformArgs(prefix string, p ocispec.Platform) map[string]string {
+	return map[string]string{
+		prefix + "PLATFORM": imageutil.FormatPlatform(p),
+		prefix + "OS":       p.OS,
+		prefix + "ARCH":     p.Architecture,
+		prefix + "VARIANT":  p.Variant,
+	}
+}
+
+// From is a FROM instruction.
+type From struct {
+	BaseImage
+	// Original is the base image as written, before build args are expanded.
+	Original string
+	// OriginalPlatform is --platform as written.
+	OriginalPlatform string
+	// Stage is the lowercased name of the stage, empty if not named.
+	Stage string
+	// External is false for scratch and references to former stages.
+	External bool
+	// StartLine and EndLine are the first and last lines of the instruction, starting from 1.
+	StartLine int
+	EndLine   int
+}
+
+// Froms parses the Dockerfile read from r and returns FROM instructions with base images
+// expanded with opts, in order. Tools editing FROM instructions, like BaseImages and Rewrite,
+// are built on it.
+func Froms(r io.Reader, opts Options) ([]From, error) {
+	result, err := parser.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	stages, metaArgs, err := instructions.Parse(result.AST)
+	if err != nil {
+		return nil, err
+	}
+
+	target := opts.TargetPlatform
+	if len(target) == 0 {
+		target = runtime.GOARCH
+	}
+	args := platformArgs("TARGET", imageutil.ParsePlatform(target))
+	for k, v := range platformArgs("BUILD", ocispec.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}) {
+		args[k] = v
+	}
+	lex := shell.NewLex(result.EscapeToken)
+	for _, arg := range metaArgs {
+		if v, ok := opts.BuildArgs[arg.Key]; ok {
+			args[arg.Key] = v
+			continue
+		}
+		if arg.Value == nil {
+			continue
+		}
+		// defaults may refer to former ARGs
+		v, err := lex.ProcessWordWithMap(*arg.Value, args)
+		if err != nil {
+			return nil, fmt.Errorf("expand ARG %s: %s", arg.Key, err)
+		}
+		args[arg.Key] = v
+	}
+
+	var fromNodes []*parser.Node
+	for _, node := range result.AST.Children {
+		if node.Value == "from" {
+			fromNodes = append(fromNodes, node)
+		}
+	}
+	froms := make([]From, len(stages))
+	stageNames := make(map[string]struct{}, len(stages))
+	for i, st := range stages {
+		ref, err := lex.ProcessWordWithMap(st.BaseName, args)
+		if err != nil {
+			return nil, fmt.Errorf("expand %s: %s", st.SourceCode, err)
+		}
+		if len(ref) == 0 {
+			return nil, fmt.Errorf("base name (%s) should not be blank", st.BaseName)
+		}
+		img := BaseImage{Ref: ref}
+		if len(st.Platform) != 0 {
+			img.Platform, err = lex.ProcessWordWithMap(st.Platform, args)
+			if err != nil {
+				return nil, fmt.Errorf("expand %s: %s", st.SourceCode, err)
+			}
+		}
+		_, isStage := stageNames[strings.ToLower(ref)]
+		// a stage can only refer to former stages
+		if len(st.Name) != 0 {
+			stageNames[st.Name] = struct{}{}
+		}
+		froms[i] = From{
+			BaseImage:        img,
+			Original:         st.BaseName,
+			OriginalPlatform: st.Platform,
+			Stage:            st.Name,
+			External:         !isStage && ref != scratch,
+			StartLine:        fromNodes[i].StartLine,
+			EndLine:          fromNodes[i].EndLine,
+		}
+	}
+	return froms, nil
+}
+
+// BaseImages returns external base images of the Dockerfile read from r in order. References to
+// former stages and scratch are skipped, and images used by multiple stages are returned once.
+func BaseImages(r io.Reader, opts Options) ([]BaseImage, error) {
+	froms, err := Froms(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	var images []BaseImage
+	seen := make(map[BaseImage]struct{}, len(froms))
+	for _, from := range froms {
+		if _, ok := seen[from.BaseImage]; ok || !from.External {
+			continue
+		}
+		seen[from.BaseImage] = struct{}{}
+		images = append(images, from.BaseImage)
+	}
+	return images, nil
+}
+
+// Rewrite replaces base images of FROM instructions in the Dockerfile data according to replace,
+// which maps expanded references returned by BaseImages to new references. FROM instructions
+// replaced are rewritten to a single line.
+func Rewrite(data []byte, opts Options, replace map[string]string) ([]byte, error) {
+	froms, err := Froms(bytes.NewReader(data), opts)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	for _, from := range froms {
+		ref, ok := replace[from.Ref]
+		if !ok || !from.External {
+			continue
+		}
+		instruction := "FROM "
+		if len(from.OriginalPlatform) != 0 {
+			instruction += "--platform=" + from.OriginalPlatform + " "
+		}
+		instruction += ref
+		if len(from.Stage) != 0 {
+			instruction += " AS " + from.Stage
+		}
+		start, end := from.StartLine-1, from.EndLine-1
+		if start < 0 || end >= len(lines) {
+			return nil, fmt.Errorf("invalid lines of FROM %s: %d-%d", from.Original, start+1, end+1)
+		}
+		lines[start] = instruction
+		for i := start + 1; i <= end; i++ {
+			lines[i] = ""
+		}
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// Refs returns references of images.
+func Refs(images []BaseImage) []string {
+	refs := make([]string, len(images))
+	for i, img := range images {
+		refs[i] = img.Ref
+	}
+	return refs
+}
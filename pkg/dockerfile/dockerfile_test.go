@@ -0,0 +1,164 @@
+package dockerfile
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestBaseImages(t *testing.T) {
+	t.Parallel()
+	dockerfile := `
+# syntax=docker/dockerfile:1
+ARG REGISTRY=registry.example.com
+ARG BASE=${REGISTRY}/base:1.0
+ARG GO_VERSION
+
+from --platform=$BUILDPLATFORM golang:${GO_VERSION:-1.14} AS Builder
+RUN go build \
+    ./...
+
+FROM builder AS test
+RUN go test ./...
+
+FROM \
+  w1/w2/w3/foo:v1.2.3
+EXPOSE 1000
+
+FROM scratch AS artifacts
+COPY --from=builder /out /
+
+FROM --platform=$TARGETPLATFORM $BASE
+COPY --from=builder /out /
+`
+	testCases := []struct {
+		name     string
+		opts     Options
+		expected []BaseImage
+	}{
+		{
+			name: "defaults",
+			opts: Options{TargetPlatform: "linux/arm64"},
+			expected: []BaseImage{
+				{Ref: "golang:1.14", Platform: buildPlatform()},
+				{Ref: "w1/w2/w3/foo:v1.2.3"},
+				{Ref: "registry.example.com/base:1.0", Platform: "linux/arm64"},
+			},
+		},
+		{
+			name: "build args",
+			opts: Options{
+				BuildArgs:      map[string]string{"GO_VERSION": "1.19", "REGISTRY": "mirror.local"},
+				TargetPlatform: "amd64",
+			},
+			expected: []BaseImage{
+				{Ref: "golang:1.19", Platform: buildPlatform()},
+				{Ref: "w1/w2/w3/foo:v1.2.3"},
+				{Ref: "mirror.local/base:1.0", Platform: "linux/amd64"},
+			},
+		},
+	}
+	for _, tC := range testCases {
+		got, err := BaseImages(strings.NewReader(dockerfile), tC.opts)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", tC.name, err)
+		}
+		if !reflect.DeepEqual(tC.expected, got) {
+			t.Errorf("%s: expected: %#v, got: %#v", tC.name, tC.expected, got)
+		}
+	}
+}
+
+func TestBaseImagesInvalid(t *testing.T) {
+	t.Parallel()
+	for _, dockerfile := range []string{
+		"FROM",
+		"ARG BASE\nFROM $BASE",
+		"FROM alpine AS 1st",
+	} {
+		if _, err := BaseImages(strings.NewReader(dockerfile), Options{}); err == nil {
+			t.Errorf("expected error for %q", dockerfile)
+		}
+	}
+}
+
+func buildPlatform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+func TestRewrite(t *testing.T) {
+	t.Parallel()
+	dockerfile := `ARG BASE=base
+FROM --platform=$BUILDPLATFORM golang:1.14 AS builder
+RUN go build ./...
+
+FROM \
+  $BASE:latest
+COPY --from=builder /out /
+`
+	expected := `ARG BASE=base
+FROM --platform=$BUILDPLATFORM golang:1.14 AS builder
+RUN go build ./...
+
+FROM registry.example.com/base:20241018
+
+COPY --from=builder /out /
+`
+	got, err := Rewrite([]byte(dockerfile), Options{}, map[string]string{
+		"base:latest": "registry.example.com/base:20241018",
+		"builder":     "should-not-be-used",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(got) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestFroms(t *testing.T) {
+	t.Parallel()
+	dockerfile := `ARG BASE=alpine:3.12
+FROM --platform=$BUILDPLATFORM golang:1.14@sha256:abc AS Builder
+RUN go build ./...
+
+FROM builder AS test
+
+FROM \
+  $BASE
+COPY --from=builder /out /
+`
+	got, err := Froms(strings.NewReader(dockerfile), Options{TargetPlatform: "linux/arm64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []From{
+		{
+			BaseImage:        BaseImage{Ref: "golang:1.14@sha256:abc", Platform: buildPlatform()},
+			Original:         "golang:1.14@sha256:abc",
+			OriginalPlatform: "$BUILDPLATFORM",
+			Stage:            "builder",
+			External:         true,
+			StartLine:        2,
+			EndLine:          2,
+		},
+		{
+			BaseImage: BaseImage{Ref: "builder"},
+			Original:  "builder",
+			Stage:     "test",
+			StartLine: 5,
+			EndLine:   5,
+		},
+		{
+			BaseImage: BaseImage{Ref: "alpine:3.12"},
+			Original:  "$BASE",
+			External:  true,
+			StartLine: 7,
+			EndLine:   8,
+		},
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("expected: %#v, got: %#v", expected, got)
+	}
+}
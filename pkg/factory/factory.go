@@ -4,7 +4,9 @@ import (
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
 
+	"github.com/iftechio/jki/pkg/config"
 	"github.com/iftechio/jki/pkg/configflags"
+	"github.com/iftechio/jki/pkg/progress"
 	"github.com/iftechio/jki/pkg/registry"
 
 	"github.com/docker/docker/client"
@@ -16,10 +18,15 @@ type Factory interface {
 	NewBuilder() *resource.Builder
 	DockerClient() (*client.Client, error)
 	LoadRegistries() (defReg string, registries map[string]*registry.Registry, err error)
+	LoadTargetRegistries() (targets []string, registries map[string]*registry.Registry, err error)
+	LoadConfig() (*config.Config, error)
 	ToResolver() (*registry.Resolver, error)
 	KubeClient() (*kubernetes.Clientset, error)
+	Cluster() string
 	ConfigPath() string
 	Platform() string
+	Progress() (progress.Mode, error)
+	Timings() *progress.Timings
 }
 
 type factoryImpl struct {
@@ -0,0 +1,169 @@
+// Package hook runs shell commands in `hooks` of the config and the project file before and after
+// operations of jki commands, e.g. to run tests before building or to update a release tracker
+// after deploying.
+package hook
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/iftechio/jki/pkg/config"
+	"github.com/iftechio/jki/pkg/image"
+	"github.com/iftechio/jki/pkg/project"
+)
+
+// Operations with hooks.
+const (
+	Build  = "build"
+	Push   = "push"
+	Copy   = "cp"
+	Deploy = "deploy"
+)
+
+// Stages of hooks.
+const (
+	Pre  = "pre"
+	Post = "post"
+)
+
+// Vars are exported to hooks as environment variables:
+//
+//	JKI_HOOK        the stage and the operation, e.g. pre-build
+//	JKI_IMAGE       the first image, e.g. registry.example.com/foo:master-abc1234
+//	JKI_IMAGES      all images separated by spaces
+//	JKI_IMAGE_NAME  the repository of JKI_IMAGE, e.g. foo
+//	JKI_TAG         the tag of JKI_IMAGE
+//	JKI_DIGEST      the digest of JKI_IMAGE, set after push and cp
+//	JKI_SOURCE      the image copied by cp
+//	JKI_NAMESPACE   the namespace of the workload updated by deploy
+//	JKI_WORKLOAD    the workload updated by deploy, e.g. deployment.apps/foo
+//	JKI_CLUSTER     the kubeconfig context of deploy
+type Vars struct {
+	Images    []string
+	Digest    string
+	Source    string
+	Namespace string
+	Workload  string
+	Cluster   string
+}
+
+// env returns vars as environment variables of the hook.
+func (v Vars) env(name string) []string {
+	var first string
+	var img image.Image
+	if len(v.Images) != 0 {
+		first = v.Images[0]
+		img = image.FromString(first)
+	}
+	return []string{
+		"JKI_HOOK=" + name,
+		"JKI_IMAGE=" + first,
+		"JKI_IMAGES=" + strings.Join(v.Images, " "),
+		"JKI_IMAGE_NAME=" + img.Repo,
+		"JKI_TAG=" + img.Tag,
+		"JKI_DIGEST=" + v.Digest,
+		"JKI_SOURCE=" + v.Source,
+		"JKI_NAMESPACE=" + v.Namespace,
+		"JKI_WORKLOAD=" + v.Workload,
+		"JKI_CLUSTER=" + v.Cluster,
+	}
+}
+
+// source is hooks of the config or the project file, run in dir.
+type source struct {
+	hooks config.Hooks
+	dir   string
+}
+
+// Runner runs hooks of the config in the working directory, then hooks of the project file in
+// the project root. A nil Runner runs nothing.
+type Runner struct {
+	sources []source
+	// stdout is where stdout of commands goes, os.Stdout by default
+	stdout io.Writer
+}
+
+// New returns a runner of hooks in cfg and p, which may be nil.
+func New(cfg *config.Config, p *project.Project) *Runner {
+	r := &Runner{stdout: os.Stdout}
+	if cfg != nil {
+		r.sources = append(r.sources, source{hooks: cfg.Hooks})
+	}
+	if p != nil {
+		r.sources = append(r.sources, source{hooks: p.Hooks, dir: p.Root})
+	}
+	return r
+}
+
+func commands(h config.Hooks, op, stage string) []string {
+	var hook config.Hook
+	switch op {
+	case Build:
+		hook = h.Build
+	case Push:
+		hook = h.Push
+	case Copy:
+		hook = h.Cp
+	case Deploy:
+		hook = h.Deploy
+	}
+	if stage == Pre {
+		return hook.Pre
+	}
+	return hook.Post
+}
+
+// SetStdout sets where stdout of commands goes, e.g. stderr if stdout is reserved for results.
+func (r *Runner) SetStdout(w io.Writer) {
+	if r != nil {
+		r.stdout = w
+	}
+}
+
+// Run runs commands of the stage of op in order, and stops at the first one that fails.
+func (r *Runner) Run(stage, op string, vars Vars) error {
+	if r == nil {
+		return nil
+	}
+	name := stage + "-" + op
+	env := append(os.Environ(), vars.env(name)...)
+	for _, s := range r.sources {
+		for _, command := range commands(s.hooks, op, stage) {
+			_, _ = fmt.Fprintf(os.Stderr, "Running %s hook: %s\n", name, command)
+			if err := run(command, s.dir, env, r.stdout); err != nil {
+				return fmt.Errorf("%s hook `%s` failed: %s", name, command, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Pre runs pre hooks of op, an error should abort op.
+func (r *Runner) Pre(op string, vars Vars) error {
+	return r.Run(Pre, op, vars)
+}
+
+// Post runs post hooks of op. op has succeeded, so a failure should be reported after the result
+// of op rather than treated as a failure of op.
+func (r *Runner) Post(op string, vars Vars) error {
+	return r.Run(Post, op, vars)
+}
+
+func run(command, dir string, env []string, stdout io.Writer) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
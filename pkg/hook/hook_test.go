@@ -0,0 +1,58 @@
+package hook
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iftechio/jki/pkg/config"
+	"github.com/iftechio/jki/pkg/project"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jki-hook-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	cfg := &config.Config{Hooks: config.Hooks{Build: config.Hook{
+		Pre:  []string{`echo "$JKI_HOOK $JKI_IMAGE_NAME $JKI_TAG $JKI_IMAGES" >> ` + out},
+		Post: []string{"exit 3", "echo unreachable >> " + out},
+	}}}
+	p := &project.Project{Root: dir, Hooks: config.Hooks{Build: config.Hook{
+		Pre: []string{"pwd >> " + out},
+	}}}
+	r := New(cfg, p)
+
+	vars := Vars{Images: []string{"registry.example.com/foo:v1", "registry.example.com/foo:latest"}}
+	if err := r.Pre(Build, vars); err != nil {
+		t.Fatal(err)
+	}
+	// no hooks of push
+	if err := r.Post(Push, vars); err != nil {
+		t.Fatal(err)
+	}
+	err = r.Post(Build, vars)
+	if err == nil || !strings.Contains(err.Error(), "post-build hook `exit 3` failed") {
+		t.Errorf("expected failure of post-build hook, got: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	realDir, _ := filepath.EvalSymlinks(dir)
+	expected := "pre-build foo v1 registry.example.com/foo:v1 registry.example.com/foo:latest\n" + realDir + "\n"
+	if string(data) != expected {
+		t.Errorf("expected output %q, got: %q", expected, data)
+	}
+
+	var nilRunner *Runner
+	if err := nilRunner.Pre(Deploy, Vars{}); err != nil {
+		t.Errorf("unexpected error of nil runner: %s", err)
+	}
+}
@@ -1,16 +1,31 @@
 package image
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+)
+
+const dockerHubHost = "docker.io"
+
+// MaxTagLength is the max length of a tag allowed by the OCI distribution spec.
+const MaxTagLength = 128
+
+var tagRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]*$`)
 
 // Image is docker image struct consist of domain, repo and tag
 type Image struct {
 	Domain string // domain or domain/namespace
 	Repo   string
 	Tag    string
+	Digest string // optional, e.g. sha256:...
 }
 
 func FromString(imageStr string) Image {
 	image := Image{}
+	if i := strings.IndexRune(imageStr, '@'); i != -1 {
+		image.Digest = imageStr[i+1:]
+		imageStr = imageStr[:i]
+	}
 	parts := strings.Split(imageStr, "/")
 	n := len(parts)
 	switch {
@@ -34,8 +49,57 @@ func FromString(imageStr string) Image {
 }
 
 func (image *Image) String() string {
-	if len(image.Domain) == 0 {
-		return image.Repo + ":" + image.Tag
+	s := image.Repo + ":" + image.Tag
+	if len(image.Domain) != 0 {
+		s = image.Domain + "/" + s
+	}
+	if len(image.Digest) != 0 {
+		s += "@" + image.Digest
 	}
-	return image.Domain + "/" + image.Repo + ":" + image.Tag
+	return s
+}
+
+// Host returns the registry host of the image, `docker.io` if the image has no explicit host.
+func (image *Image) Host() string {
+	first := strings.SplitN(image.Domain, "/", 2)[0]
+	if isHost(first) {
+		return first
+	}
+	return dockerHubHost
+}
+
+// Path returns the repository path used in the registry API, e.g. `library/nginx`.
+func (image *Image) Path() string {
+	namespace := image.Domain
+	parts := strings.SplitN(image.Domain, "/", 2)
+	if isHost(parts[0]) {
+		namespace = ""
+		if len(parts) == 2 {
+			namespace = parts[1]
+		}
+	}
+	if len(namespace) == 0 {
+		if image.Host() == dockerHubHost {
+			return "library/" + image.Repo
+		}
+		return image.Repo
+	}
+	return namespace + "/" + image.Repo
+}
+
+// Reference returns the digest if present, otherwise the tag.
+func (image *Image) Reference() string {
+	if len(image.Digest) != 0 {
+		return image.Digest
+	}
+	return image.Tag
+}
+
+func isHost(s string) bool {
+	return strings.ContainsAny(s, ".:") || s == "localhost"
+}
+
+// IsValidTag reports whether tag matches the tag grammar of the OCI distribution spec.
+func IsValidTag(tag string) bool {
+	return len(tag) <= MaxTagLength && tagRegexp.MatchString(tag)
 }
@@ -1,6 +1,7 @@
 package image
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -61,3 +62,78 @@ func TestFromString(t *testing.T) {
 		}
 	}
 }
+
+func TestFromStringWithDigest(t *testing.T) {
+	img := FromString("foo/nginx:alpine@sha256:abc")
+	if img.Repo != "nginx" || img.Tag != "alpine" || img.Digest != "sha256:abc" {
+		t.Fatalf("unexpected image: %#v", img)
+	}
+	if img.String() != "foo/nginx:alpine@sha256:abc" {
+		t.Fatalf("unexpected string: %s", img.String())
+	}
+}
+
+func TestHostAndPath(t *testing.T) {
+	testCases := []struct {
+		image string
+		host  string
+		path  string
+	}{
+		{
+			image: "nginx:alpine",
+			host:  "docker.io",
+			path:  "library/nginx",
+		},
+		{
+			image: "foo/nginx:alpine",
+			host:  "docker.io",
+			path:  "foo/nginx",
+		},
+		{
+			image: "registry.cn-hangzhou.aliyuncs.com/foo/a-service:master-foo",
+			host:  "registry.cn-hangzhou.aliyuncs.com",
+			path:  "foo/a-service",
+		},
+		{
+			image: "123.dkr.ecr.cn-north-1.amazonaws.com.cn/nginx:latest",
+			host:  "123.dkr.ecr.cn-north-1.amazonaws.com.cn",
+			path:  "nginx",
+		},
+		{
+			image: "localhost:5000/a/b/c:v1",
+			host:  "localhost:5000",
+			path:  "a/b/c",
+		},
+	}
+	for _, tC := range testCases {
+		img := FromString(tC.image)
+		if img.Host() != tC.host {
+			t.Errorf("wrong host, got: %s, expected: %s", img.Host(), tC.host)
+		}
+		if img.Path() != tC.path {
+			t.Errorf("wrong path, got: %s, expected: %s", img.Path(), tC.path)
+		}
+	}
+}
+
+func TestIsValidTag(t *testing.T) {
+	testCases := []struct {
+		tag   string
+		valid bool
+	}{
+		{tag: "latest", valid: true},
+		{tag: "master-abc1234", valid: true},
+		{tag: "v1.2.3_rc.1", valid: true},
+		{tag: "", valid: false},
+		{tag: "-foo", valid: false},
+		{tag: ".foo", valid: false},
+		{tag: "feature/foo", valid: false},
+		{tag: strings.Repeat("a", 128), valid: true},
+		{tag: strings.Repeat("a", 129), valid: false},
+	}
+	for _, tC := range testCases {
+		if IsValidTag(tC.tag) != tC.valid {
+			t.Errorf("IsValidTag(%q) should be %v", tC.tag, tC.valid)
+		}
+	}
+}
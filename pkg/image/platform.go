@@ -0,0 +1,43 @@
+package image
+
+import (
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ParsePlatform parses platform strings like `amd64`, `linux/arm64` or `linux/arm/v7`.
+// The OS defaults to linux.
+func ParsePlatform(s string) ocispec.Platform {
+	parts := strings.Split(s, "/")
+	p := ocispec.Platform{OS: "linux"}
+	switch len(parts) {
+	case 1:
+		p.Architecture = parts[0]
+	case 2:
+		p.OS, p.Architecture = parts[0], parts[1]
+	default:
+		p.OS, p.Architecture, p.Variant = parts[0], parts[1], parts[2]
+	}
+	return p
+}
+
+// FormatPlatform formats p as `os/arch[/variant]`.
+func FormatPlatform(p ocispec.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if len(p.Variant) != 0 {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// MatchPlatform reports whether p satisfies want. An empty variant in want matches any variant.
+func MatchPlatform(p *ocispec.Platform, want ocispec.Platform) bool {
+	if p == nil {
+		return false
+	}
+	if p.OS != want.OS || p.Architecture != want.Architecture {
+		return false
+	}
+	return len(want.Variant) == 0 || p.Variant == want.Variant
+}
@@ -0,0 +1,126 @@
+// Package imagetag computes tags of built images from git metadata and orders version tags.
+package imagetag
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/iftechio/jki/pkg/git"
+	imageutil "github.com/iftechio/jki/pkg/image"
+)
+
+// TemplateHelp describes variables of tag templates.
+const TemplateHelp = `Tag template variables, e.g. release-{date}-{short_sha}:
+  {branch}       current branch, lowercased with invalid chars replaced by "-"
+  {sha}          full commit hash
+  {short_sha}    abbreviated commit hash
+  {tag}          git tag pointing at HEAD, empty if none
+  {commit_date}  commit date, 20060102
+  {commit_time}  commit time, 20060102150405
+  {date}         build date, 20060102
+  {time}         build time, 20060102150405
+  {dirty}        "-dirty" if there are uncommitted changes, otherwise empty
+  {env.NAME}     environment variable NAME`
+
+var (
+	tagVarRegexp     = regexp.MustCompile(`\{([^{}]*)\}`)
+	invalidTagRegexp = regexp.MustCompile(`[^a-z0-9_.-]+`)
+)
+
+// sanitizeTag lowercases s and replaces chars not allowed in tags with "-".
+func sanitizeTag(s string) string {
+	return invalidTagRegexp.ReplaceAllString(strings.ToLower(s), "-")
+}
+
+// tagVar returns the value of the tag template variable name.
+func tagVar(name string, now time.Time) (string, error) {
+	if strings.HasPrefix(name, "env.") {
+		return os.Getenv(strings.TrimPrefix(name, "env.")), nil
+	}
+	switch name {
+	case "branch":
+		branch, err := git.GetCurrentBranch()
+		if err != nil {
+			return "", fmt.Errorf("get current branch: %s", err)
+		}
+		return sanitizeTag(branch), nil
+	case "sha":
+		return git.GetCommitHash()
+	case "short_sha":
+		return git.GetAbbrevCommitHash()
+	case "tag":
+		hash, err := git.GetAbbrevCommitHash()
+		if err != nil {
+			return "", err
+		}
+		// no tag points at HEAD
+		tag, _ := git.GetTagOfCommit(hash)
+		return tag, nil
+	case "commit_date", "commit_time":
+		t, err := git.GetCommitTime()
+		if err != nil {
+			return "", fmt.Errorf("get commit time: %s", err)
+		}
+		if name == "commit_date" {
+			return t.Format("20060102"), nil
+		}
+		return t.Format("20060102150405"), nil
+	case "date":
+		return now.Format("20060102"), nil
+	case "time":
+		return now.Format("20060102150405"), nil
+	case "dirty":
+		if git.HasChanges() {
+			return "-dirty", nil
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("unknown variable {%s} in tag template", name)
+}
+
+// Render replaces variables in tmpl and validates the result against the OCI tag grammar.
+func Render(tmpl string, now time.Time) (string, error) {
+	var err error
+	tag := tagVarRegexp.ReplaceAllStringFunc(tmpl, func(s string) string {
+		if err != nil {
+			return ""
+		}
+		var v string
+		v, err = tagVar(s[1:len(s)-1], now)
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	if !imageutil.IsValidTag(tag) {
+		return "", fmt.Errorf("invalid tag %q rendered from template %q: a tag must match [a-zA-Z0-9_][a-zA-Z0-9._-]* and be at most %d chars",
+			tag, tmpl, imageutil.MaxTagLength)
+	}
+	return tag, nil
+}
+
+// Compute returns the tag rendered from tmpl. Without a template the tag is the git tag of HEAD,
+// or else `<branch>-<short sha>`, or `latest` outside a git repository.
+func Compute(tmpl string) (string, error) {
+	if len(tmpl) != 0 {
+		return Render(tmpl, time.Now())
+	}
+	currentHash, err := git.GetAbbrevCommitHash()
+	if err != nil {
+		fmt.Println("WARNING: cannot get current commit, use `latest` as tag.")
+		return "latest", nil
+	}
+	tag, err := git.GetTagOfCommit(currentHash)
+	if err == nil {
+		return tag, nil
+	}
+	branch, err := git.GetCurrentBranch()
+	if err != nil {
+		return "", err
+	}
+	tag = fmt.Sprintf("%s-%s", branch, currentHash)
+	return strings.ToLower(strings.ReplaceAll(tag, "/", "-")), nil
+}
@@ -0,0 +1,51 @@
+package imagetag
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	now := time.Date(2024, 10, 18, 9, 30, 0, 0, time.Local)
+	_ = os.Setenv("JKI_TEST_STAGE", "rc1")
+	defer os.Unsetenv("JKI_TEST_STAGE")
+
+	testCases := []struct {
+		tmpl    string
+		tag     string
+		wantErr bool
+	}{
+		{tmpl: "release-{date}", tag: "release-20241018"},
+		{tmpl: "{date}{time}", tag: "2024101820241018093000"},
+		{tmpl: "v1-{env.JKI_TEST_STAGE}", tag: "v1-rc1"},
+		{tmpl: "{unknown}", wantErr: true},
+		{tmpl: "{env.JKI_TEST_UNSET}", wantErr: true},
+		{tmpl: "-{date}", wantErr: true},
+		{tmpl: "a/{date}", wantErr: true},
+		{tmpl: strings.Repeat("a", 121) + "{date}", wantErr: true},
+	}
+	for _, tC := range testCases {
+		tag, err := Render(tC.tmpl, now)
+		if tC.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error, got tag %q", tC.tmpl, tag)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tC.tmpl, err)
+			continue
+		}
+		if tag != tC.tag {
+			t.Errorf("wrong tag of %s, got: %s, expected: %s", tC.tmpl, tag, tC.tag)
+		}
+	}
+}
+
+func TestSanitizeTag(t *testing.T) {
+	if s := sanitizeTag("Feature/Foo+bar"); s != "feature-foo-bar" {
+		t.Errorf("wrong sanitized tag: %s", s)
+	}
+}
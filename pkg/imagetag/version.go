@@ -0,0 +1,117 @@
+package imagetag
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VersionKind is the scheme a tag is ordered by.
+type VersionKind string
+
+const (
+	// Semver tags look like 1.14, v1.2.3 or 3.12-alpine.
+	Semver VersionKind = "semver"
+	// Date tags contain a date, e.g. 20240101, 2024-01-01 or release-20240101093000-abc123.
+	Date VersionKind = "date"
+)
+
+var (
+	semverRegexp = regexp.MustCompile(`^(v?)(\d+(?:\.\d+){0,3})(-[a-zA-Z][a-zA-Z0-9._-]*)?$`)
+	dateRegexp   = regexp.MustCompile(`^([a-zA-Z0-9._-]*?[._-])?(\d{4}-\d{2}-\d{2}|\d{14}|\d{8})([._-][a-zA-Z0-9._-]*)?$`)
+	dateLayouts  = map[int]string{8: "20060102", 10: "2006-01-02", 14: "20060102150405"}
+)
+
+// Version is a tag parsed for ordering.
+type Version struct {
+	Tag  string
+	Kind VersionKind
+	// variant identifies tags comparable with each other, e.g. 1.14-alpine is only compared with
+	// tags like 1.15-alpine, but not with 1.15, 1.15.2-alpine or 1.15-buster.
+	variant string
+	nums    []int64
+}
+
+// ParseVersion parses tag as a date or semver tag. ok is false if it is neither, e.g. latest or
+// master-abc123.
+func ParseVersion(tag string) (v *Version, ok bool) {
+	if m := dateRegexp.FindStringSubmatch(tag); m != nil {
+		layout := dateLayouts[len(m[2])]
+		if t, err := time.Parse(layout, m[2]); err == nil {
+			return &Version{
+				Tag:     tag,
+				Kind:    Date,
+				variant: m[1] + layout,
+				nums:    []int64{t.Unix()},
+			}, true
+		}
+	}
+	m := semverRegexp.FindStringSubmatch(tag)
+	if m == nil {
+		return nil, false
+	}
+	parts := strings.Split(m[2], ".")
+	v = &Version{
+		Tag:     tag,
+		Kind:    Semver,
+		variant: fmt.Sprintf("%s%d%s", m[1], len(parts), m[3]),
+		nums:    make([]int64, len(parts)),
+	}
+	for i, p := range parts {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		v.nums[i] = n
+	}
+	return v, true
+}
+
+// Comparable reports whether v and other are ordered by the same scheme and variant.
+func (v *Version) Comparable(other *Version) bool {
+	return v.Kind == other.Kind && v.variant == other.variant
+}
+
+// Major returns the major version of semver tags. Date tags have no major version.
+func (v *Version) Major() (int64, bool) {
+	if v.Kind != Semver {
+		return 0, false
+	}
+	return v.nums[0], true
+}
+
+// Less reports whether v is older than other. Both must be comparable.
+func (v *Version) Less(other *Version) bool {
+	for i := range v.nums {
+		if v.nums[i] != other.nums[i] {
+			return v.nums[i] < other.nums[i]
+		}
+	}
+	return v.Tag < other.Tag
+}
+
+// Latest returns the latest tags comparable with current: the latest tag of the same major
+// version, and the latest of all. They are current if there is no newer tag. sameMajor is empty
+// for date tags.
+func Latest(current *Version, tags []string) (sameMajor, latest string) {
+	major, hasMajor := current.Major()
+	latestVer, sameMajorVer := current, current
+	for _, tag := range tags {
+		v, ok := ParseVersion(tag)
+		if !ok || !current.Comparable(v) {
+			continue
+		}
+		if latestVer.Less(v) {
+			latestVer = v
+		}
+		if m, _ := v.Major(); hasMajor && m == major && sameMajorVer.Less(v) {
+			sameMajorVer = v
+		}
+	}
+	if hasMajor {
+		sameMajor = sameMajorVer.Tag
+	}
+	return sameMajor, latestVer.Tag
+}
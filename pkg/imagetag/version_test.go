@@ -0,0 +1,74 @@
+package imagetag
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		tag  string
+		kind VersionKind
+		ok   bool
+	}{
+		{tag: "1.14", kind: Semver, ok: true},
+		{tag: "v1.2.3", kind: Semver, ok: true},
+		{tag: "3.12-alpine", kind: Semver, ok: true},
+		{tag: "20240101", kind: Date, ok: true},
+		{tag: "2024-01-01", kind: Date, ok: true},
+		{tag: "release-20240101093000-abc123", kind: Date, ok: true},
+		{tag: "latest"},
+		{tag: "master-abc123"},
+		{tag: "1.2.3-1"},
+	}
+	for _, tC := range testCases {
+		v, ok := ParseVersion(tC.tag)
+		if ok != tC.ok {
+			t.Errorf("%s: expected ok: %t, got: %t", tC.tag, tC.ok, ok)
+			continue
+		}
+		if ok && v.Kind != tC.kind {
+			t.Errorf("%s: expected kind: %s, got: %s", tC.tag, tC.kind, v.Kind)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	testCases := []struct {
+		current   string
+		tags      []string
+		sameMajor string
+		latest    string
+	}{
+		{
+			current:   "1.14",
+			tags:      []string{"1.13", "1.14", "1.15", "1.9", "2.0", "2.1-rc1", "2.1.0", "latest"},
+			sameMajor: "1.15",
+			latest:    "2.0",
+		},
+		{
+			current:   "v1.2.3-alpine",
+			tags:      []string{"v1.2.10-alpine", "v1.3.0", "v2.0.0-alpine", "1.4.0-alpine"},
+			sameMajor: "v1.2.10-alpine",
+			latest:    "v2.0.0-alpine",
+		},
+		{
+			current: "release-20240101-abc",
+			tags:    []string{"release-20231231-fff", "release-20240301-def", "20250101", "master-abc"},
+			latest:  "release-20240301-def",
+		},
+		{
+			current:   "3.12",
+			tags:      []string{"3.10", "3.11"},
+			sameMajor: "3.12",
+			latest:    "3.12",
+		},
+	}
+	for _, tC := range testCases {
+		current, ok := ParseVersion(tC.current)
+		if !ok {
+			t.Fatalf("%s: failed to parse", tC.current)
+		}
+		sameMajor, latest := Latest(current, tC.tags)
+		if sameMajor != tC.sameMajor || latest != tC.latest {
+			t.Errorf("%s: expected: %q %q, got: %q %q", tC.current, tC.sameMajor, tC.latest, sameMajor, latest)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+// Package notify sends events of jki commands to webhooks in `notifications` of the config, so
+// that results are visible to the team instead of only the desktop of the user.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iftechio/jki/pkg/config"
+	"github.com/iftechio/jki/pkg/git"
+)
+
+// Names of events.
+const (
+	BuildSuccess  = "build.success"
+	BuildFailure  = "build.failure"
+	CopySuccess   = "cp.success"
+	CopyFailure   = "cp.failure"
+	DeploySuccess = "deploy.success"
+	DeployFailure = "deploy.failure"
+	// TransferImage is sent when transferimage fixes images of a workload.
+	TransferImage = "transferimage.fixed"
+)
+
+var titles = map[string]string{
+	BuildSuccess:  "镜像构建并上传成功",
+	BuildFailure:  "镜像构建失败",
+	CopySuccess:   "镜像复制成功",
+	CopyFailure:   "镜像复制失败",
+	DeploySuccess: "镜像部署成功",
+	DeployFailure: "镜像部署失败",
+	TransferImage: "镜像已迁移",
+}
+
+// Types of notifications.
+const (
+	TypeWebhook  = "webhook"
+	TypeSlack    = "slack"
+	TypeDingTalk = "dingtalk"
+	TypeLark     = "lark"
+	TypeWeCom    = "wecom"
+)
+
+// Event is what happened in a command.
+type Event struct {
+	Name   string
+	Images []string
+	// Source is the image copied by cp or transferimage.
+	Source    string
+	Commit    string
+	User      string
+	Cluster   string
+	Namespace string
+	// Workload is the resource updated by deploy or transferimage, e.g. deployment/foo.
+	Workload string
+	Duration time.Duration
+	Err      error
+	Time     time.Time
+}
+
+// NewEvent returns an event with the abbreviated commit of HEAD and the current user.
+func NewEvent(name string, images ...string) Event {
+	ev := Event{Name: name, Images: images, Time: time.Now()}
+	// not in a git repository
+	ev.Commit, _ = git.GetAbbrevCommitHash()
+	if u, err := user.Current(); err == nil {
+		ev.User = u.Username
+	} else {
+		ev.User = os.Getenv("USER")
+	}
+	return ev
+}
+
+// Title returns the summary of the event.
+func (ev *Event) Title() string {
+	if t, ok := titles[ev.Name]; ok {
+		return t
+	}
+	return ev.Name
+}
+
+// lines returns fields of the event to show in chat messages.
+func (ev *Event) lines() []string {
+	var lines []string
+	add := func(name, value string) {
+		if len(value) != 0 {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
+	add("镜像", strings.Join(ev.Images, ", "))
+	add("源镜像", ev.Source)
+	add("Workload", ev.Workload)
+	add("集群", ev.Cluster)
+	add("Namespace", ev.Namespace)
+	add("Commit", ev.Commit)
+	add("用户", ev.User)
+	if ev.Duration != 0 {
+		add("耗时", ev.Duration.Round(100*time.Millisecond).String())
+	}
+	if ev.Err != nil {
+		add("错误", ev.Err.Error())
+	}
+	return lines
+}
+
+// payload is the body of generic webhooks.
+type payload struct {
+	Event     string    `json:"event"`
+	Title     string    `json:"title"`
+	Images    []string  `json:"images,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Workload  string    `json:"workload,omitempty"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Commit    string    `json:"commit,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Duration  float64   `json:"duration_seconds,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// Notifier sends events to webhooks. A nil Notifier sends nothing.
+type Notifier struct {
+	targets []config.Notification
+	client  *http.Client
+	// attempts is the max number of requests to a webhook, and the delay between them doubles
+	// from backoff
+	attempts int
+	backoff  time.Duration
+}
+
+// New returns a notifier of the webhooks.
+func New(targets []config.Notification) (*Notifier, error) {
+	targets = append([]config.Notification(nil), targets...)
+	for i, t := range targets {
+		switch t.Type {
+		case "":
+			targets[i].Type = TypeWebhook
+		case TypeWebhook, TypeSlack, TypeDingTalk, TypeLark, TypeWeCom:
+		default:
+			return nil, fmt.Errorf("unknown type of notification: %s, expected one of webhook, slack, dingtalk, lark and wecom", t.Type)
+		}
+		if len(t.URL) == 0 {
+			return nil, fmt.Errorf("url of %s notification is required", targets[i].Type)
+		}
+		for _, pattern := range t.Events {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid event pattern %q: %s", pattern, err)
+			}
+		}
+	}
+	return &Notifier{
+		targets:  targets,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		attempts: 3,
+		backoff:  time.Second,
+	}, nil
+}
+
+func subscribed(t config.Notification, name string) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, pattern := range t.Events {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Send posts the event to webhooks subscribed to it, and returns errors of webhooks still failing
+// after retries.
+func (n *Notifier) Send(ctx context.Context, ev Event) error {
+	if n == nil {
+		return nil
+	}
+	var errs []string
+	for _, t := range n.targets {
+		if !subscribed(t, ev.Name) {
+			continue
+		}
+		if err := n.post(ctx, t, ev); err != nil {
+			errs = append(errs, fmt.Sprintf("%s notification: %s", t.Type, err))
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Notify sends the event and only prints a warning if it fails, notifications never fail
+// commands.
+func (n *Notifier) Notify(ev Event) {
+	if err := n.Send(context.TODO(), ev); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "WARNING: %s\n", err)
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, t config.Notification, ev Event) error {
+	var err error
+	delay := n.backoff
+	for i := 0; i < n.attempts; i++ {
+		if i != 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			delay *= 2
+		}
+		var retry bool
+		retry, err = n.postOnce(ctx, t, ev)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+// sign returns the signature of dingtalk and lark robots.
+func sign(secret string, timestamp int64, lark bool) string {
+	stringToSign := fmt.Sprintf("%d\n%s", timestamp, secret)
+	var mac hash.Hash
+	if lark {
+		// lark signs nothing with the string as the key
+		mac = hmac.New(sha256.New, []byte(stringToSign))
+	} else {
+		mac = hmac.New(sha256.New, []byte(secret))
+		_, _ = mac.Write([]byte(stringToSign))
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// request returns the URL and the body in the format of the webhook.
+func request(t config.Notification, ev Event, now time.Time) (string, interface{}, error) {
+	title, lines := ev.Title(), ev.lines()
+	switch t.Type {
+	case TypeSlack:
+		return t.URL, map[string]string{"text": fmt.Sprintf("*%s*\n%s", title, strings.Join(lines, "\n"))}, nil
+	case TypeDingTalk:
+		u := t.URL
+		if len(t.Secret) != 0 {
+			ms := now.UnixNano() / int64(time.Millisecond)
+			parsed, err := url.Parse(u)
+			if err != nil {
+				return "", nil, err
+			}
+			q := parsed.Query()
+			q.Set("timestamp", strconv.FormatInt(ms, 10))
+			q.Set("sign", sign(t.Secret, ms, false))
+			parsed.RawQuery = q.Encode()
+			u = parsed.String()
+		}
+		text := "### " + title + "\n\n- " + strings.Join(lines, "\n- ")
+		return u, map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"title": title, "text": text},
+		}, nil
+	case TypeLark:
+		body := map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": title + "\n" + strings.Join(lines, "\n")},
+		}
+		if len(t.Secret) != 0 {
+			ts := now.Unix()
+			body["timestamp"] = strconv.FormatInt(ts, 10)
+			body["sign"] = sign(t.Secret, ts, true)
+		}
+		return t.URL, body, nil
+	case TypeWeCom:
+		content := "**" + title + "**\n> " + strings.Join(lines, "\n> ")
+		return t.URL, map[string]interface{}{
+			"msgtype":  "markdown",
+			"markdown": map[string]string{"content": content},
+		}, nil
+	}
+	p := payload{
+		Event:     ev.Name,
+		Title:     title,
+		Images:    ev.Images,
+		Source:    ev.Source,
+		Workload:  ev.Workload,
+		Cluster:   ev.Cluster,
+		Namespace: ev.Namespace,
+		Commit:    ev.Commit,
+		User:      ev.User,
+		Duration:  ev.Duration.Seconds(),
+		Time:      ev.Time,
+	}
+	if ev.Err != nil {
+		p.Error = ev.Err.Error()
+	}
+	return t.URL, p, nil
+}
+
+// chatResponse is the body of responses of chat robots, which report errors with status 200.
+type chatResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+}
+
+// postOnce sends the event once and reports whether it should be retried on error.
+func (n *Notifier) postOnce(ctx context.Context, t config.Notification, ev Event) (bool, error) {
+	u, body, err := request(t, ev, time.Now())
+	if err != nil {
+		return false, err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if t.Type == TypeDingTalk || t.Type == TypeLark || t.Type == TypeWeCom {
+		var cr chatResponse
+		if err := json.Unmarshal(respBody, &cr); err == nil {
+			if cr.ErrCode != 0 {
+				return false, fmt.Errorf("error %d: %s", cr.ErrCode, cr.ErrMsg)
+			}
+			if cr.Code != 0 {
+				return false, fmt.Errorf("error %d: %s", cr.Code, cr.Msg)
+			}
+		}
+	}
+	return false, nil
+}
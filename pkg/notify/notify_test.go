@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iftechio/jki/pkg/config"
+)
+
+// server records bodies of requests and responds with statuses in order, then 200.
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   []map[string]interface{}
+	queries  []string
+}
+
+func newServer(statuses ...int) *server {
+	s := &server{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		data, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		_ = json.Unmarshal(data, &body)
+		s.bodies = append(s.bodies, body)
+		s.queries = append(s.queries, r.URL.RawQuery)
+		status := http.StatusOK
+		if len(s.statuses) != 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+		if r.URL.Path == "/robot" {
+			_, _ = w.Write([]byte(`{"errcode":310000,"errmsg":"keywords not in content"}`))
+		}
+	}))
+	return s
+}
+
+func newNotifier(t *testing.T, targets ...config.Notification) *Notifier {
+	n, err := New(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.backoff = time.Millisecond
+	return n
+}
+
+func TestSendRetry(t *testing.T) {
+	s := newServer(http.StatusBadGateway, http.StatusServiceUnavailable)
+	defer s.Close()
+	n := newNotifier(t, config.Notification{URL: s.URL, Events: []string{"build.*"}})
+
+	ev := Event{
+		Name:     BuildFailure,
+		Images:   []string{"registry.example.com/foo:master-abc123"},
+		Commit:   "abc123",
+		User:     "alice",
+		Duration: 1500 * time.Millisecond,
+		Err:      errors.New("exit code 1"),
+	}
+	if err := n.Send(context.TODO(), ev); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(s.bodies) != 3 {
+		t.Fatalf("expected 3 requests, got: %d", len(s.bodies))
+	}
+	body := s.bodies[2]
+	if body["event"] != BuildFailure || body["commit"] != "abc123" || body["user"] != "alice" ||
+		body["error"] != "exit code 1" || body["duration_seconds"] != 1.5 {
+		t.Errorf("wrong payload: %v", body)
+	}
+
+	// not subscribed
+	if err := n.Send(context.TODO(), Event{Name: DeploySuccess}); err != nil || len(s.bodies) != 3 {
+		t.Errorf("unexpected request for unsubscribed event, err: %v", err)
+	}
+}
+
+func TestSendFailure(t *testing.T) {
+	s := newServer(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusBadRequest)
+	defer s.Close()
+	n := newNotifier(t, config.Notification{URL: s.URL})
+	if err := n.Send(context.TODO(), Event{Name: CopySuccess}); err == nil {
+		t.Error("expected error after retries")
+	}
+	if len(s.bodies) != 3 {
+		t.Errorf("expected 3 requests, got: %d", len(s.bodies))
+	}
+	// client errors are not retried
+	if err := n.Send(context.TODO(), Event{Name: CopySuccess}); err == nil || len(s.bodies) != 4 {
+		t.Errorf("expected one failed request, got: %d requests, err: %v", len(s.bodies), err)
+	}
+	// errors of chat robots are reported with status 200
+	n = newNotifier(t, config.Notification{Type: TypeDingTalk, URL: s.URL + "/robot"})
+	if err := n.Send(context.TODO(), Event{Name: CopySuccess}); err == nil || !strings.Contains(err.Error(), "keywords") {
+		t.Errorf("expected error of the robot, got: %v", err)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+	n := newNotifier(t,
+		config.Notification{Type: TypeSlack, URL: s.URL},
+		config.Notification{Type: TypeDingTalk, URL: s.URL + "?access_token=foo", Secret: "SEC"},
+		config.Notification{Type: TypeLark, URL: s.URL, Secret: "SEC"},
+		config.Notification{Type: TypeWeCom, URL: s.URL},
+	)
+	ev := Event{Name: DeploySuccess, Images: []string{"foo:v1"}, Cluster: "prod", Namespace: "web", Workload: "deployment/foo"}
+	if err := n.Send(context.TODO(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.bodies) != 4 {
+		t.Fatalf("expected 4 requests, got: %d", len(s.bodies))
+	}
+	if text, _ := s.bodies[0]["text"].(string); !strings.HasPrefix(text, "*镜像部署成功*\n") || !strings.Contains(text, "集群: prod") {
+		t.Errorf("wrong slack message: %q", text)
+	}
+	if s.bodies[1]["msgtype"] != "markdown" || !strings.Contains(s.queries[1], "access_token=foo") ||
+		!strings.Contains(s.queries[1], "sign=") || !strings.Contains(s.queries[1], "timestamp=") {
+		t.Errorf("wrong dingtalk request: %v %s", s.bodies[1], s.queries[1])
+	}
+	if s.bodies[2]["msg_type"] != "text" || s.bodies[2]["sign"] == nil {
+		t.Errorf("wrong lark request: %v", s.bodies[2])
+	}
+	md, _ := s.bodies[3]["markdown"].(map[string]interface{})
+	if content, _ := md["content"].(string); !strings.Contains(content, "> Workload: deployment/foo") {
+		t.Errorf("wrong wecom message: %v", s.bodies[3])
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, target := range []config.Notification{
+		{Type: "teams", URL: "http://example.com"},
+		{Type: TypeSlack},
+		{URL: "http://example.com", Events: []string{"["}},
+	} {
+		if _, err := New([]config.Notification{target}); err == nil {
+			t.Errorf("expected error for %+v", target)
+		}
+	}
+}
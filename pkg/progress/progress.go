@@ -0,0 +1,220 @@
+// Package progress displays progress of builds, pushes, pulls and downloads in the mode given by
+// the global `--progress` flag.
+package progress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containerd/console"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/term"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/util/progress/progressui"
+)
+
+// Mode is how progress is displayed.
+type Mode string
+
+const (
+	// Auto is TTY in a terminal and Plain otherwise.
+	Auto Mode = "auto"
+	// TTY redraws progress bars in place.
+	TTY Mode = "tty"
+	// Plain prints a line with a timestamp for each step, suitable for CI logs.
+	Plain Mode = "plain"
+	// JSON prints a JSON object per line.
+	JSON Mode = "json"
+)
+
+// buildKitTraceID is the ID of messages carrying statuses of buildkit in the stream of the docker
+// daemon.
+const buildKitTraceID = "moby.buildkit.trace"
+
+// TimeFormat is the format of timestamps of plain progress.
+const TimeFormat = "15:04:05.000"
+
+// ParseMode parses the value of `--progress`.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case Auto, TTY, Plain, JSON:
+		return m, nil
+	case "":
+		return Auto, nil
+	}
+	return "", fmt.Errorf("invalid progress mode: %s, expected auto, tty, plain or json", s)
+}
+
+// Resolve returns TTY or Plain for Auto according to whether f is a terminal.
+func (m Mode) Resolve(f *os.File) Mode {
+	if m != Auto {
+		return m
+	}
+	if term.IsTerminal(f.Fd()) {
+		return TTY
+	}
+	return Plain
+}
+
+// Timestamp returns the prefix of plain progress lines.
+func Timestamp(t time.Time) string {
+	return "[" + t.Format(TimeFormat) + "] "
+}
+
+// timestampWriter prefixes each line written to it with the current time.
+type timestampWriter struct {
+	w         io.Writer
+	midOfLine bool
+}
+
+func (tw *timestampWriter) Write(p []byte) (int, error) {
+	var buf []byte
+	for _, b := range p {
+		if !tw.midOfLine {
+			buf = append(buf, Timestamp(time.Now())...)
+			tw.midOfLine = true
+		}
+		buf = append(buf, b)
+		if b == '\n' {
+			tw.midOfLine = false
+		}
+	}
+	if _, err := tw.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewTimestampWriter returns a writer prefixing each line with the current time.
+func NewTimestampWriter(w io.Writer) io.Writer {
+	return &timestampWriter{w: w}
+}
+
+// DisplaySolveStatus displays statuses of a buildkit solve from ch until it is closed. Steps are
+// recorded in timings if it is not nil.
+func DisplaySolveStatus(ctx context.Context, mode Mode, out *os.File, timings *Timings, ch chan *bkclient.SolveStatus) error {
+	mode = mode.Resolve(out)
+	if timings != nil {
+		ch = timings.observe(ch)
+	}
+	switch mode {
+	case TTY:
+		c, err := console.ConsoleFromFile(out)
+		if err != nil {
+			c = nil
+		}
+		return progressui.DisplaySolveStatus(ctx, "", c, out, ch)
+	case JSON:
+		enc := json.NewEncoder(out)
+		for status := range ch {
+			if err := enc.Encode(status); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return progressui.DisplaySolveStatus(ctx, "", nil, NewTimestampWriter(out), ch)
+	}
+}
+
+// DisplayJSONMessages displays the JSON message stream of the docker daemon from in, and calls
+// auxCallback with aux messages if it is not nil. Progress of layers and build steps is recorded
+// in timings if it is not nil.
+func DisplayJSONMessages(in io.Reader, mode Mode, out *os.File, timings *Timings, auxCallback func(jsonmessage.JSONMessage)) error {
+	mode = mode.Resolve(out)
+	if mode == TTY {
+		if timings != nil {
+			in = io.TeeReader(in, NewMessageWriter(func(msg jsonmessage.JSONMessage) {
+				timings.observeMessage(msg, time.Now())
+			}))
+		}
+		fd, isTerm := term.GetFdInfo(out)
+		return jsonmessage.DisplayJSONMessagesStream(in, out, fd, isTerm, auxCallback)
+	}
+
+	dec := json.NewDecoder(in)
+	enc := json.NewEncoder(out)
+	// plain progress prints each status of a layer once instead of every progress update
+	lastStatus := make(map[string]string)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		now := time.Now()
+		if timings != nil {
+			timings.observeMessage(msg, now)
+		}
+		switch status, seen := lastStatus[msg.ID]; {
+		case msg.ID == buildKitTraceID:
+			// statuses of buildkit are displayed by DisplaySolveStatus
+		case mode == JSON:
+			if msg.Time == 0 && msg.TimeNano == 0 {
+				msg.TimeNano = now.UnixNano()
+			}
+			if err := enc.Encode(msg); err != nil {
+				return err
+			}
+		case !seen || status != msg.Status || len(msg.ID) == 0:
+			lastStatus[msg.ID] = msg.Status
+			printPlain(out, msg, now)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if msg.Aux != nil && auxCallback != nil {
+			auxCallback(msg)
+		}
+	}
+}
+
+func printPlain(out io.Writer, msg jsonmessage.JSONMessage, now time.Time) {
+	switch {
+	case len(msg.Stream) != 0:
+		for _, line := range strings.Split(strings.TrimRight(msg.Stream, "\n"), "\n") {
+			fmt.Fprintf(out, "%s%s\n", Timestamp(now), line)
+		}
+	case len(msg.ID) != 0 && len(msg.Status) != 0:
+		fmt.Fprintf(out, "%s%s: %s\n", Timestamp(now), msg.ID, msg.Status)
+	case len(msg.Status) != 0:
+		fmt.Fprintf(out, "%s%s\n", Timestamp(now), msg.Status)
+	}
+}
+
+// MessageWriter decodes the JSON message stream of the docker daemon written to it, and calls
+// observe on each message. It is used with io.TeeReader so that the stream can still be
+// displayed.
+type MessageWriter struct {
+	buf     []byte
+	observe func(jsonmessage.JSONMessage)
+}
+
+// NewMessageWriter returns a MessageWriter calling observe.
+func NewMessageWriter(observe func(jsonmessage.JSONMessage)) *MessageWriter {
+	return &MessageWriter{observe: observe}
+}
+
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+		var msg jsonmessage.JSONMessage
+		if err := json.Unmarshal(w.buf[:i], &msg); err == nil {
+			w.observe(msg)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
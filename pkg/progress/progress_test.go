@@ -0,0 +1,88 @@
+package progress
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	testCases := []struct {
+		s       string
+		mode    Mode
+		wantErr bool
+	}{
+		{s: "", mode: Auto},
+		{s: "plain", mode: Plain},
+		{s: "json", mode: JSON},
+		{s: "fancy", wantErr: true},
+	}
+	for _, tC := range testCases {
+		mode, err := ParseMode(tC.s)
+		if tC.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tC.s)
+			}
+			continue
+		}
+		if err != nil || mode != tC.mode {
+			t.Errorf("%s: got mode %q, err %v, expected: %s", tC.s, mode, err, tC.mode)
+		}
+	}
+}
+
+func TestDisplayJSONMessagesPlain(t *testing.T) {
+	stream := `{"status":"Preparing","id":"abc"}
+{"status":"Pushing","progressDetail":{"current":1,"total":10},"id":"abc"}
+{"status":"Pushing","progressDetail":{"current":5,"total":10},"id":"abc"}
+{"status":"Pushed","id":"abc"}
+{"stream":"Step 1/2 : FROM alpine\n"}
+{"id":"moby.buildkit.trace","aux":"AA=="}
+`
+	out, err := ioutil.TempFile("", "jki-progress-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+
+	timings := NewTimings()
+	if err := DisplayJSONMessages(strings.NewReader(stream), Plain, out, timings, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := regexp.MustCompile(`^\[\d{2}:\d{2}:\d{2}\.\d{3}\] `)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !ts.MatchString(line) {
+			t.Errorf("line without timestamp: %q", line)
+		}
+		lines = append(lines, ts.ReplaceAllString(line, ""))
+	}
+	expected := []string{"abc: Preparing", "abc: Pushing", "abc: Pushed", "Step 1/2 : FROM alpine"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong output, got: %q, expected: %q", lines, expected)
+	}
+	if len(timings.steps) != 2 {
+		t.Errorf("wrong number of steps: %d", len(timings.steps))
+	}
+}
+
+func TestTimestampWriter(t *testing.T) {
+	var sb strings.Builder
+	w := NewTimestampWriter(&sb)
+	_, _ = w.Write([]byte("#1 [1/2] FROM"))
+	_, _ = w.Write([]byte(" alpine\n#1 DONE\n"))
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("wrong number of lines: %q", sb.String())
+	}
+	if !strings.HasSuffix(lines[0], "] #1 [1/2] FROM alpine") || !strings.HasSuffix(lines[1], "] #1 DONE") {
+		t.Errorf("wrong output: %q", sb.String())
+	}
+}
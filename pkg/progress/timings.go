@@ -0,0 +1,132 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	bkclient "github.com/moby/buildkit/client"
+)
+
+type step struct {
+	name      string
+	started   time.Time
+	completed time.Time
+	cached    bool
+}
+
+// Timings records durations of steps for the summary printed by `--progress-summary`. It is safe
+// for concurrent use.
+type Timings struct {
+	mu    sync.Mutex
+	steps map[string]*step
+	// current is the key of the running step of the legacy builder
+	current string
+}
+
+// NewTimings returns empty timings.
+func NewTimings() *Timings {
+	return &Timings{steps: make(map[string]*step)}
+}
+
+func (t *Timings) update(key, name string, at time.Time) *step {
+	s, ok := t.steps[key]
+	if !ok {
+		s = &step{name: name, started: at}
+		t.steps[key] = s
+	}
+	if at.After(s.completed) {
+		s.completed = at
+	}
+	return s
+}
+
+// Add records a step which is not reported through buildkit or the docker daemon.
+func (t *Timings) Add(name string, started, completed time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.steps[fmt.Sprintf("%s-%d", name, len(t.steps))] = &step{name: name, started: started, completed: completed}
+}
+
+// observe returns a channel of statuses from ch, whose vertexes are recorded.
+func (t *Timings) observe(ch chan *bkclient.SolveStatus) chan *bkclient.SolveStatus {
+	out := make(chan *bkclient.SolveStatus)
+	go func() {
+		defer close(out)
+		for status := range ch {
+			t.observeStatus(status)
+			out <- status
+		}
+	}()
+	return out
+}
+
+func (t *Timings) observeStatus(status *bkclient.SolveStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, v := range status.Vertexes {
+		if v.Started == nil {
+			continue
+		}
+		s := t.update(v.Digest.String(), v.Name, *v.Started)
+		s.started = *v.Started
+		if v.Completed != nil {
+			s.completed = *v.Completed
+		}
+		s.cached = v.Cached
+	}
+}
+
+// observeMessage records steps of the legacy builder and layers pushed or pulled.
+func (t *Timings) observeMessage(msg jsonmessage.JSONMessage, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case strings.HasPrefix(msg.Stream, "Step "):
+		t.current = fmt.Sprintf("step-%d", len(t.steps))
+		t.update(t.current, strings.TrimSpace(msg.Stream), at)
+	case len(msg.Stream) != 0 && len(t.current) != 0:
+		s := t.update(t.current, "", at)
+		if strings.Contains(msg.Stream, "Using cache") {
+			s.cached = true
+		}
+	case len(msg.ID) != 0 && len(msg.Status) != 0:
+		t.update("layer-"+msg.ID, "layer "+msg.ID, at)
+	}
+}
+
+// Print writes durations of steps in the order they started.
+func (t *Timings) Print(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.steps) == 0 {
+		return
+	}
+	steps := make([]*step, 0, len(t.steps))
+	var first, last time.Time
+	for _, s := range t.steps {
+		steps = append(steps, s)
+		if first.IsZero() || s.started.Before(first) {
+			first = s.started
+		}
+		if s.completed.After(last) {
+			last = s.completed
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].started.Before(steps[j].started)
+	})
+	fmt.Fprintln(w, "Timing summary:")
+	for _, s := range steps {
+		var cached string
+		if s.cached {
+			cached = " CACHED"
+		}
+		fmt.Fprintf(w, "%8.2fs  %s%s\n", s.completed.Sub(s.started).Seconds(), s.name, cached)
+	}
+	fmt.Fprintf(w, "%8.2fs  total\n", last.Sub(first).Seconds())
+}
@@ -0,0 +1,141 @@
+// Package project loads the project file `.jki/project.yaml` committed with a service.
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/iftechio/jki/pkg/config"
+)
+
+// FileName is the path of the project file relative to the project root.
+var FileName = filepath.Join(".jki", "project.yaml")
+
+// Project describes how to build and deploy the image of a service. Relative paths are relative
+// to the project root, the directory containing `.jki`.
+type Project struct {
+	Image `json:",inline"`
+	// Images are images of a monorepo. Build args, labels and registries of the project
+	// are shared by all images.
+	Images []Image `json:"images"`
+	// Hooks run after those in config, in the project root.
+	Hooks config.Hooks `json:"hooks"`
+
+	// Root is the project root.
+	Root string `json:"-"`
+}
+
+// Image describes an image to build.
+type Image struct {
+	Name       string            `json:"name"`
+	Dockerfile string            `json:"dockerfile"`
+	Context    string            `json:"context"`
+	BuildArgs  map[string]string `json:"build-args"`
+	Labels     map[string]string `json:"labels"`
+	// Registries are names of registries in config to push to.
+	Registries []string       `json:"registries"`
+	Deploy     []DeployTarget `json:"deploy"`
+	// Paths are watched by `jki build --since`, defaults to the context and the Dockerfile.
+	Paths []string `json:"paths"`
+}
+
+// DeployTarget is a workload updated by `jki deploy`.
+type DeployTarget struct {
+	// Resource is the workload to update, e.g. `deployment/foo` or `sts/bar`.
+	// Defaults to the deployment with the same name as the image.
+	Resource  string `json:"resource"`
+	Container string `json:"container"`
+	Namespace string `json:"namespace"`
+}
+
+// Find looks for the project file in dir and its parents, and loads the first one found.
+// nil is returned if there is no project file.
+func Find(dir string) (*Project, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		fp := filepath.Join(dir, FileName)
+		if _, err := os.Stat(fp); err == nil {
+			return Load(fp)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads the project file fp.
+func Load(fp string) (*Project, error) {
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	var p Project
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("decode %s: %s", fp, err)
+	}
+	fp, err = filepath.Abs(fp)
+	if err != nil {
+		return nil, err
+	}
+	p.Root = filepath.Dir(filepath.Dir(fp))
+	return &p, nil
+}
+
+// Path resolves p relative to the project root.
+func (p *Project) Path(rel string) string {
+	if filepath.IsAbs(rel) {
+		return rel
+	}
+	return filepath.Join(p.Root, rel)
+}
+
+func mergeMap(base, m map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(m))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range m {
+		merged[k] = v
+	}
+	return merged
+}
+
+// ImageOf returns the image name in Images, with build args, labels and registries of the
+// project applied and paths resolved to absolute paths.
+func (p *Project) ImageOf(name string) (Image, bool) {
+	for _, img := range p.Images {
+		if img.Name != name {
+			continue
+		}
+		img.BuildArgs = mergeMap(p.BuildArgs, img.BuildArgs)
+		img.Labels = mergeMap(p.Labels, img.Labels)
+		if len(img.Registries) == 0 {
+			img.Registries = p.Registries
+		}
+		img.Context = p.Path(img.Context)
+		if len(img.Dockerfile) == 0 {
+			img.Dockerfile = filepath.Join(img.Context, "Dockerfile")
+		} else {
+			img.Dockerfile = p.Path(img.Dockerfile)
+		}
+		paths := make([]string, len(img.Paths))
+		for i, path := range img.Paths {
+			paths[i] = p.Path(path)
+		}
+		if len(paths) == 0 {
+			paths = []string{img.Context, img.Dockerfile}
+		}
+		img.Paths = paths
+		return img, true
+	}
+	return Image{}, false
+}
@@ -0,0 +1,63 @@
+package project
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const projectYAML = `name: foo
+dockerfile: build/Dockerfile
+context: src
+build-args:
+  GOPROXY: https://goproxy.cn
+registries:
+- ali
+deploy:
+- resource: sts/foo
+  container: app
+`
+
+func TestFind(t *testing.T) {
+	root, err := ioutil.TempDir("", "jki-project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, ".jki"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, FileName), []byte(projectYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(root, "src", "cmd")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Find(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p == nil {
+		t.Fatal("project not found")
+	}
+	if p.Root != root {
+		t.Errorf("wrong root, got: %s, expected: %s", p.Root, root)
+	}
+	if p.Name != "foo" || p.BuildArgs["GOPROXY"] != "https://goproxy.cn" {
+		t.Errorf("wrong project: %+v", p)
+	}
+	if got := p.Path(p.Dockerfile); got != filepath.Join(root, "build", "Dockerfile") {
+		t.Errorf("wrong dockerfile path: %s", got)
+	}
+	if len(p.Deploy) != 1 || p.Deploy[0].Resource != "sts/foo" || p.Deploy[0].Container != "app" {
+		t.Errorf("wrong deploy targets: %+v", p.Deploy)
+	}
+
+	p, err = Find(os.TempDir())
+	if err != nil || p != nil {
+		t.Errorf("expected no project, got: %+v, %v", p, err)
+	}
+}
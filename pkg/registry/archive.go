@@ -0,0 +1,136 @@
+package registry
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// archiveManifest is an entry of manifest.json in tars written by `docker save`.
+type archiveManifest struct {
+	Config string
+	Layers []string
+}
+
+// pushFile pushes the file fp as a blob of mediaType unless it exists in repo, and reports
+// whether it is uploaded.
+func (c *Client) pushFile(ctx context.Context, repo, mediaType, fp string) (ocispec.Descriptor, bool, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return ocispec.Descriptor{}, false, err
+	}
+	defer f.Close()
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(digester.Hash(), f)
+	if err != nil {
+		return ocispec.Descriptor{}, false, err
+	}
+	desc := ocispec.Descriptor{MediaType: mediaType, Digest: digester.Digest(), Size: size}
+	exists, err := c.BlobExists(ctx, repo, desc.Digest)
+	if err != nil || exists {
+		return desc, false, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return desc, false, err
+	}
+	if err := c.PushBlob(ctx, repo, desc, f); err != nil {
+		return desc, false, err
+	}
+	return desc, true, nil
+}
+
+// compress writes the gzip compressed fp into dir and returns the path.
+func compress(fp, dir string) (string, error) {
+	src, err := os.Open(fp)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := ioutil.TempFile(dir, "layer-*.tar.gz")
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// PushArchive pushes the image in the tar r written by `docker save` to repo without a tag.
+// Layers are compressed with gzip. The manifest is put by digest and its descriptor is returned,
+// so the image can be referenced by a manifest list without leaving tags in the repository.
+// pushed is the total size of blobs uploaded, blobs already existing in repo are not counted.
+func (c *Client) PushArchive(ctx context.Context, repo string, r io.Reader) (ocispec.Descriptor, int64, error) {
+	dir, err := ioutil.TempDir("", "jki-image-")
+	if err != nil {
+		return ocispec.Descriptor{}, 0, err
+	}
+	defer os.RemoveAll(dir)
+	if err := archive.Untar(r, dir, &archive.TarOptions{NoLchown: true}); err != nil {
+		return ocispec.Descriptor{}, 0, fmt.Errorf("extract image: %s", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return ocispec.Descriptor{}, 0, err
+	}
+	var entries []archiveManifest
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return ocispec.Descriptor{}, 0, fmt.Errorf("decode manifest.json: %s", err)
+	}
+	if len(entries) != 1 {
+		return ocispec.Descriptor{}, 0, fmt.Errorf("expected 1 image in the archive, got: %d", len(entries))
+	}
+	// paths in manifest.json are relative to the root of the tar
+	path := func(name string) string {
+		return filepath.Join(dir, filepath.Clean("/"+name))
+	}
+
+	m := Manifest{SchemaVersion: 2, MediaType: MediaTypeDockerManifest}
+	var pushed int64
+	config, uploaded, err := c.pushFile(ctx, repo, MediaTypeDockerConfig, path(entries[0].Config))
+	if err != nil {
+		return ocispec.Descriptor{}, 0, fmt.Errorf("push config: %s", err)
+	}
+	m.Config = config
+	if uploaded {
+		pushed += config.Size
+	}
+	for _, layer := range entries[0].Layers {
+		fp, err := compress(path(layer), dir)
+		if err != nil {
+			return ocispec.Descriptor{}, 0, fmt.Errorf("compress %s: %s", layer, err)
+		}
+		desc, uploaded, err := c.pushFile(ctx, repo, MediaTypeDockerLayer, fp)
+		os.Remove(fp)
+		if err != nil {
+			return ocispec.Descriptor{}, 0, fmt.Errorf("push layer %s: %s", layer, err)
+		}
+		if uploaded {
+			pushed += desc.Size
+		}
+		m.Layers = append(m.Layers, desc)
+	}
+	data, err = json.Marshal(m)
+	if err != nil {
+		return ocispec.Descriptor{}, 0, err
+	}
+	desc := ocispec.Descriptor{MediaType: m.MediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+	if _, err := c.PutManifest(ctx, repo, desc.Digest.String(), desc.MediaType, data); err != nil {
+		return ocispec.Descriptor{}, 0, err
+	}
+	return desc, pushed, nil
+}
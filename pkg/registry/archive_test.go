@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func dockerSaveTar(t *testing.T, files map[string][]byte) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPushArchive(t *testing.T) {
+	t.Parallel()
+	config := []byte(`{"architecture":"arm64","os":"linux"}`)
+	layer := []byte("layer content")
+	archive := dockerSaveTar(t, map[string][]byte{
+		"manifest.json": []byte(`[{"Config":"abc.json","RepoTags":["foo:v1-linux-arm64"],"Layers":["l1/layer.tar"]}]`),
+		"abc.json":      config,
+		"l1/layer.tar":  layer,
+		"l1/VERSION":    []byte("1.0"),
+		"repositories":  []byte(`{}`),
+	})
+
+	var (
+		mu        sync.Mutex
+		blobs     = make(map[string][]byte)
+		manifests = make(map[string][]byte)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/ns/app/blobs/"):
+			if _, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/ns/app/blobs/")]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/v2/ns/app/blobs/uploads/":
+			w.Header().Set("Location", "/v2/ns/app/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == http.MethodPut && r.URL.Path == "/v2/ns/app/blobs/uploads/1":
+			data, _ := ioutil.ReadAll(r.Body)
+			dgst := r.URL.Query().Get("digest")
+			if digest.FromBytes(data).String() != dgst {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			blobs[dgst] = data
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v2/ns/app/manifests/"):
+			data, _ := ioutil.ReadAll(r.Body)
+			manifests[strings.TrimPrefix(r.URL.Path, "/v2/ns/app/manifests/")] = data
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	reg := &Registry{DockerHub: &DockerHubRegistry{Server: "localhost"}}
+	c := NewClient(reg, strings.TrimPrefix(srv.URL, "http://"))
+	c.http = srv.Client()
+	desc, pushed, err := c.PushArchive(context.Background(), "ns/app", bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(manifests) != 1 || manifests[desc.Digest.String()] == nil {
+		t.Fatalf("expected the manifest to be put by digest %s only, got: %v", desc.Digest, manifests)
+	}
+	var m Manifest
+	if err := json.Unmarshal(manifests[desc.Digest.String()], &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.MediaType != MediaTypeDockerManifest || m.Config.Digest != digest.FromBytes(config) || len(m.Layers) != 1 {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	if !bytes.Equal(blobs[m.Config.Digest.String()], config) {
+		t.Errorf("config is not pushed")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(blobs[m.Layers[0].Digest.String()]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(zr)
+	if !bytes.Equal(data, layer) || m.Layers[0].MediaType != MediaTypeDockerLayer {
+		t.Errorf("unexpected layer: %q %+v", data, m.Layers[0])
+	}
+	if pushed != m.Config.Size+m.Layers[0].Size {
+		t.Errorf("expected pushed size: %d, got: %d", m.Config.Size+m.Layers[0].Size, pushed)
+	}
+
+	// existing blobs are not uploaded again
+	_, pushed, err = c.PushArchive(context.Background(), "ns/app", bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed != 0 {
+		t.Errorf("expected nothing pushed, got: %d", pushed)
+	}
+}
@@ -0,0 +1,583 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerConfig       = "application/vnd.docker.container.image.v1+json"
+	MediaTypeDockerLayer        = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+var (
+	ErrNotFound = fmt.Errorf("not found")
+)
+
+var manifestMediaTypes = []string{
+	MediaTypeDockerManifest,
+	MediaTypeDockerManifestList,
+	ocispec.MediaTypeImageManifest,
+	ocispec.MediaTypeImageIndex,
+}
+
+// IsIndex reports whether mediaType is a manifest list or an OCI index.
+func IsIndex(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifestList || mediaType == ocispec.MediaTypeImageIndex
+}
+
+// Manifest covers both docker schema2 manifests and OCI image manifests.
+type Manifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType,omitempty"`
+	Config        ocispec.Descriptor   `json:"config"`
+	Layers        []ocispec.Descriptor `json:"layers"`
+	Annotations   map[string]string    `json:"annotations,omitempty"`
+}
+
+// Index covers both docker manifest lists and OCI image indexes.
+type Index struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType,omitempty"`
+	Manifests     []ocispec.Descriptor `json:"manifests"`
+	Annotations   map[string]string    `json:"annotations,omitempty"`
+}
+
+// Client talks to a registry through the Docker Registry HTTP API V2.
+type Client struct {
+	host string
+	reg  Interface
+	http *http.Client
+
+	mu        sync.Mutex
+	auth      *types.AuthConfig
+	challenge *challenge
+	tokens    map[string]bearerToken
+}
+
+// bearerToken is a token of the token server, which expires after expires_in seconds of issued_at.
+type bearerToken struct {
+	value   string
+	expires time.Time
+}
+
+const (
+	// defaultTokenExpiry is the lifetime of tokens without expires_in, as in the token spec.
+	defaultTokenExpiry = 60 * time.Second
+	// tokenExpiryMargin renews tokens before they expire during a request.
+	tokenExpiryMargin = 10 * time.Second
+)
+
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+// NewClient returns a client of `host` using the credentials of `reg`.
+func NewClient(reg Interface, host string) *Client {
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	return &Client{
+		host:   host,
+		reg:    reg,
+		http:   http.DefaultClient,
+		tokens: make(map[string]bearerToken),
+	}
+}
+
+func (c *Client) url(format string, args ...interface{}) string {
+	scheme := "https"
+	if strings.HasPrefix(c.host, "localhost") || strings.HasPrefix(c.host, "127.0.0.1") {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/", scheme, c.host) + fmt.Sprintf(format, args...)
+}
+
+// HeadManifest returns the descriptor of the manifest `ref` (tag or digest) in `repo`.
+// ErrNotFound is returned if it does not exist.
+func (c *Client) HeadManifest(ctx context.Context, repo, ref string) (ocispec.Descriptor, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.url("%s/manifests/%s", repo, ref), nil)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := c.do(req, pullScope(repo))
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	dgst, err := digest.Parse(resp.Header.Get("Docker-Content-Digest"))
+	if err != nil {
+		// some registries omit the digest header for HEAD requests
+		_, desc, err := c.GetManifest(ctx, repo, ref)
+		return desc, err
+	}
+	return ocispec.Descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    dgst,
+		Size:      resp.ContentLength,
+	}, nil
+}
+
+// GetManifest fetches the raw manifest `ref` (tag or digest) in `repo`.
+func (c *Client) GetManifest(ctx context.Context, repo, ref string) ([]byte, ocispec.Descriptor, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("%s/manifests/%s", repo, ref), nil)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := c.do(req, pullScope(repo))
+	if err != nil {
+		return nil, ocispec.Descriptor{}, err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return nil, ocispec.Descriptor{}, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, err
+	}
+	mediaType := resp.Header.Get("Content-Type")
+	if i := strings.IndexRune(mediaType, ';'); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	if len(mediaType) == 0 || mediaType == "application/json" {
+		var probe struct {
+			MediaType string `json:"mediaType"`
+		}
+		_ = json.Unmarshal(data, &probe)
+		mediaType = probe.MediaType
+	}
+	return data, ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}, nil
+}
+
+// PutManifest uploads a raw manifest as `ref` (tag or digest) in `repo`.
+func (c *Client) PutManifest(ctx context.Context, repo, ref, mediaType string, data []byte) (digest.Digest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url("%s/manifests/%s", repo, ref), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mediaType)
+	resp, err := c.do(req, pushScope(repo))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusCreated, http.StatusOK); err != nil {
+		return "", fmt.Errorf("put manifest %s:%s: %s", repo, ref, err)
+	}
+	return digest.FromBytes(data), nil
+}
+
+// BlobExists reports whether the blob `dgst` exists in `repo`.
+func (c *Client) BlobExists(ctx context.Context, repo string, dgst digest.Digest) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.url("%s/blobs/%s", repo, dgst), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.do(req, pullScope(repo))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	err = checkStatus(resp, http.StatusOK)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetBlob opens the blob `dgst` in `repo`. The caller must close the returned reader.
+func (c *Client) GetBlob(ctx context.Context, repo string, dgst digest.Digest) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("%s/blobs/%s", repo, dgst), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, pullScope(repo))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("get blob %s: %s", dgst, err)
+	}
+	return resp.Body, nil
+}
+
+// MountBlob tries to mount the blob `dgst` from repository `from` into `repo` without
+// transferring data. It returns false if the registry does not support or refuses the mount.
+func (c *Client) MountBlob(ctx context.Context, repo, from string, dgst digest.Digest) (bool, error) {
+	u := c.url("%s/blobs/uploads/?mount=%s&from=%s", repo, url.QueryEscape(dgst.String()), url.QueryEscape(from))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.do(req, pushScope(repo), pullScope(from))
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		return true, nil
+	case http.StatusAccepted:
+		// the registry started a regular upload instead, cancel it
+		if loc, err := c.location(resp); err == nil {
+			if req, err := http.NewRequestWithContext(ctx, http.MethodDelete, loc, nil); err == nil {
+				if resp, err := c.do(req, pushScope(repo)); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, checkStatus(resp)
+}
+
+// PushBlob uploads the content of `desc` read from `r` into `repo` as a monolithic upload.
+func (c *Client) PushBlob(ctx context.Context, repo string, desc ocispec.Descriptor, r io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("%s/blobs/uploads/", repo), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, pushScope(repo))
+	if err != nil {
+		return err
+	}
+	// checkStatus reads the error from the body, which is closed before the upload
+	err = checkStatus(resp, http.StatusAccepted)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("start upload of %s: %s", desc.Digest, err)
+	}
+	loc, err := c.location(resp)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("digest", desc.Digest.String())
+	u.RawQuery = q.Encode()
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, u.String(), ioutil.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = desc.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err = c.do(req, pushScope(repo))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusCreated); err != nil {
+		return fmt.Errorf("upload %s: %s", desc.Digest, err)
+	}
+	return nil
+}
+
+// ListTags returns all tags of `repo`.
+func (c *Client) ListTags(ctx context.Context, repo string) ([]string, error) {
+	var tags []string
+	next := c.url("%s/tags/list", repo)
+	for len(next) != 0 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req, pullScope(repo))
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(resp, http.StatusOK); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("list tags of %s: %s", repo, err)
+		}
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, body.Tags...)
+		next = ""
+		if link := resp.Header.Get("Link"); len(link) != 0 {
+			// Link: </v2/foo/tags/list?n=100&last=bar>; rel="next"
+			start, end := strings.IndexRune(link, '<'), strings.IndexRune(link, '>')
+			if start != -1 && end > start {
+				if u, err := resp.Request.URL.Parse(link[start+1 : end]); err == nil {
+					next = u.String()
+				}
+			}
+		}
+	}
+	return tags, nil
+}
+
+func (c *Client) location(resp *http.Response) (string, error) {
+	loc := resp.Header.Get("Location")
+	if len(loc) == 0 {
+		return "", fmt.Errorf("missing Location header")
+	}
+	u, err := resp.Request.URL.Parse(loc)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (c *Client) do(req *http.Request, scopes ...string) (*http.Response, error) {
+	if err := c.authorize(req, scopes); err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	ch := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+	if ch == nil || (req.Body != nil && req.GetBody == nil) {
+		return resp, nil
+	}
+	resp.Body.Close()
+	c.mu.Lock()
+	c.challenge = ch
+	// the token may be revoked or expired earlier than expected
+	delete(c.tokens, tokenKey(scopes))
+	if scope, ok := ch.params["scope"]; ok {
+		scopes = append(scopes, scope)
+		delete(c.tokens, tokenKey(scopes))
+	}
+	c.mu.Unlock()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.authorize(retry, scopes); err != nil {
+		return nil, err
+	}
+	return c.http.Do(retry)
+}
+
+func (c *Client) authorize(req *http.Request, scopes []string) error {
+	c.mu.Lock()
+	ch := c.challenge
+	c.mu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	auth, err := c.authConfig()
+	if err != nil {
+		return err
+	}
+	switch ch.scheme {
+	case "basic":
+		if len(auth.Username) != 0 {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+	case "bearer":
+		token, err := c.token(req.Context(), ch, auth, scopes)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+func (c *Client) authConfig() (types.AuthConfig, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.auth != nil {
+		return *c.auth, nil
+	}
+	auth, err := c.reg.GetAuthConfig()
+	if err != nil {
+		return auth, err
+	}
+	c.auth = &auth
+	return auth, nil
+}
+
+func tokenKey(scopes []string) string {
+	return strings.Join(uniqueStrings(scopes), " ")
+}
+
+func (c *Client) token(ctx context.Context, ch *challenge, auth types.AuthConfig, scopes []string) (string, error) {
+	scopes = uniqueStrings(scopes)
+	key := tokenKey(scopes)
+	c.mu.Lock()
+	cached, ok := c.tokens[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	u, err := url.Parse(ch.params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("invalid realm: %s", err)
+	}
+	q := u.Query()
+	if service, ok := ch.params["service"]; ok {
+		q.Set("service", service)
+	}
+	for _, scope := range scopes {
+		q.Add("scope", scope)
+	}
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if len(auth.Username) != 0 {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return "", fmt.Errorf("fetch token: %s", err)
+	}
+	var body struct {
+		Token       string    `json:"token"`
+		AccessToken string    `json:"access_token"`
+		ExpiresIn   int       `json:"expires_in"`
+		IssuedAt    time.Time `json:"issued_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode token: %s", err)
+	}
+	token := bearerToken{value: body.Token}
+	if len(token.value) == 0 {
+		token.value = body.AccessToken
+	}
+	issuedAt, expiry := body.IssuedAt, defaultTokenExpiry
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+	if body.ExpiresIn > 0 {
+		expiry = time.Duration(body.ExpiresIn) * time.Second
+	}
+	token.expires = issuedAt.Add(expiry - tokenExpiryMargin)
+	c.mu.Lock()
+	c.tokens[key] = token
+	c.mu.Unlock()
+	return token.value, nil
+}
+
+// parseChallenge parses `WWW-Authenticate` headers like
+// `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`.
+func parseChallenge(header string) *challenge {
+	i := strings.IndexRune(header, ' ')
+	if i == -1 {
+		if len(header) == 0 {
+			return nil
+		}
+		return &challenge{scheme: strings.ToLower(header)}
+	}
+	ch := &challenge{
+		scheme: strings.ToLower(header[:i]),
+		params: make(map[string]string),
+	}
+	rest := header[i+1:]
+	for len(rest) != 0 {
+		eq := strings.IndexRune(rest, '=')
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexRune(rest[1:], '"')
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexRune(rest, ',')
+			if end == -1 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		ch.params[key] = value
+		rest = strings.TrimLeft(rest, ", ")
+	}
+	return ch
+}
+
+func checkStatus(resp *http.Response, expected ...int) error {
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unexpected status: %d %s", resp.StatusCode, strings.TrimSpace(string(data)))
+}
+
+func pullScope(repo string) string {
+	return fmt.Sprintf("repository:%s:pull", repo)
+}
+
+func pushScope(repo string) string {
+	return fmt.Sprintf("repository:%s:pull,push", repo)
+}
+
+func uniqueStrings(ss []string) []string {
+	mem := make(map[string]struct{}, len(ss))
+	ret := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if _, ok := mem[s]; ok {
+			continue
+		}
+		mem[s] = struct{}{}
+		ret = append(ret, s)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+)
+
+func TestParseChallenge(t *testing.T) {
+	t.Parallel()
+	ch := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`)
+	if ch == nil || ch.scheme != "bearer" {
+		t.Fatalf("unexpected challenge: %#v", ch)
+	}
+	expected := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/nginx:pull",
+	}
+	if !reflect.DeepEqual(expected, ch.params) {
+		t.Fatalf("expected: %#v, got: %#v", expected, ch.params)
+	}
+}
+
+func TestClientBearerAuth(t *testing.T) {
+	t.Parallel()
+	manifest := []byte(`{"schemaVersion":2}`)
+	dgst := digest.FromBytes(manifest)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			user, passwd, _ := r.BasicAuth()
+			if user != "foo" || passwd != "bar" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"token":"t0ken"}`)
+		case r.Header.Get("Authorization") != "Bearer t0ken":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/ns/app/manifests/v1":
+			w.Header().Set("Content-Type", MediaTypeDockerManifest)
+			w.Header().Set("Docker-Content-Digest", dgst.String())
+			_, _ = w.Write(manifest)
+		case r.URL.Path == "/v2/ns/app/tags/list" && r.URL.Query().Get("last") == "":
+			w.Header().Set("Link", `</v2/ns/app/tags/list?last=v1>; rel="next"`)
+			_, _ = fmt.Fprint(w, `{"tags":["v1"]}`)
+		case r.URL.Path == "/v2/ns/app/tags/list":
+			_, _ = fmt.Fprint(w, `{"tags":["v2"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	reg := &Registry{DockerHub: &DockerHubRegistry{Server: "localhost", Username: "foo", Password: "bar"}}
+	c := NewClient(reg, strings.TrimPrefix(srv.URL, "http://"))
+	c.http = srv.Client()
+	ctx := context.Background()
+
+	desc, err := c.HeadManifest(ctx, "ns/app", "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != dgst {
+		t.Fatalf("got: %s, expected: %s", desc.Digest, dgst)
+	}
+
+	_, err = c.HeadManifest(ctx, "ns/app", "v3")
+	if err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got: %v", err)
+	}
+
+	tags, err := c.ListTags(ctx, "ns/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"v1", "v2"}) {
+		t.Fatalf("unexpected tags: %v", tags)
+	}
+}
+
+func TestClientTokenRenewal(t *testing.T) {
+	t.Parallel()
+	manifest := []byte(`{"schemaVersion":2}`)
+	dgst := digest.FromBytes(manifest)
+
+	for _, tc := range []struct {
+		name string
+		// issuedAt of tokens, tokens issued long ago are expired when fetched
+		issuedAt string
+		// rejectUsed makes the server reject a token after it is used once, e.g. revoked
+		rejectUsed     bool
+		expectedTokens int
+	}{
+		{name: "cached", issuedAt: time.Now().UTC().Format(time.RFC3339), expectedTokens: 1},
+		{name: "expired", issuedAt: "2020-01-01T00:00:00Z", expectedTokens: 3},
+		{name: "rejected", issuedAt: time.Now().UTC().Format(time.RFC3339), rejectUsed: true, expectedTokens: 3},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				mu     sync.Mutex
+				issued int
+				used   = make(map[string]bool)
+				srv    *httptest.Server
+			)
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if r.URL.Path == "/token" {
+					issued++
+					_, _ = fmt.Fprintf(w, `{"token":"t%d","expires_in":60,"issued_at":%q}`, issued, tc.issuedAt)
+					return
+				}
+				token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if len(token) == 0 || (tc.rejectUsed && used[token]) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				used[token] = true
+				w.Header().Set("Content-Type", MediaTypeDockerManifest)
+				w.Header().Set("Docker-Content-Digest", dgst.String())
+				_, _ = w.Write(manifest)
+			}))
+			defer srv.Close()
+
+			reg := &Registry{DockerHub: &DockerHubRegistry{Server: "localhost"}}
+			c := NewClient(reg, strings.TrimPrefix(srv.URL, "http://"))
+			c.http = srv.Client()
+			for i := 0; i < 3; i++ {
+				if _, err := c.HeadManifest(context.Background(), "ns/app", "v1"); err != nil {
+					t.Fatalf("request %d: %s", i, err)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if issued != tc.expectedTokens {
+				t.Errorf("expected %d tokens, got: %d", tc.expectedTokens, issued)
+			}
+		})
+	}
+}
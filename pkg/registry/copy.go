@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Host returns the registry host the client talks to.
+func (c *Client) Host() string {
+	return c.host
+}
+
+// CopyBlob copies the blob desc from srcRepo to dstRepo unless it already exists. When both
+// repositories are on the same host, the blob is mounted instead of transferring data.
+func CopyBlob(ctx context.Context, src *Client, srcRepo string, dst *Client, dstRepo string, desc ocispec.Descriptor) error {
+	exists, err := dst.BlobExists(ctx, dstRepo, desc.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if src.Host() == dst.Host() {
+		mounted, err := dst.MountBlob(ctx, dstRepo, srcRepo, desc.Digest)
+		if err != nil {
+			return err
+		}
+		if mounted {
+			return nil
+		}
+	}
+	rc, err := src.GetBlob(ctx, srcRepo, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return dst.PushBlob(ctx, dstRepo, desc, rc)
+}
+
+// CopyManifest copies the manifest or index `desc` with everything it references from srcRepo
+// to dstRepo, then puts it as `ref`. Manifests referenced by an index are put by digest.
+func CopyManifest(ctx context.Context, src *Client, srcRepo string, dst *Client, dstRepo string, desc ocispec.Descriptor, raw []byte, ref string) error {
+	if raw == nil {
+		var err error
+		raw, _, err = src.GetManifest(ctx, srcRepo, desc.Digest.String())
+		if err != nil {
+			return err
+		}
+	}
+	if IsIndex(desc.MediaType) {
+		var index Index
+		if err := json.Unmarshal(raw, &index); err != nil {
+			return fmt.Errorf("decode index: %s", err)
+		}
+		if srcRepo != dstRepo || src.Host() != dst.Host() {
+			for _, m := range index.Manifests {
+				if err := CopyManifest(ctx, src, srcRepo, dst, dstRepo, m, nil, m.Digest.String()); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		var manifest Manifest
+		if err := json.Unmarshal(raw, &manifest); err != nil {
+			return fmt.Errorf("decode manifest: %s", err)
+		}
+		if srcRepo != dstRepo || src.Host() != dst.Host() {
+			for _, blob := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+				if err := CopyBlob(ctx, src, srcRepo, dst, dstRepo, blob); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	_, err := dst.PutManifest(ctx, dstRepo, ref, desc.MediaType, raw)
+	return err
+}
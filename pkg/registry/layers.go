@@ -0,0 +1,45 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Layer is a layer of an image with the instruction that created it.
+type Layer struct {
+	Digest string
+	// Size is the compressed size in the registry.
+	Size      int64
+	CreatedBy string
+}
+
+// Layers returns layers of the image `ref` in `repo` for platform, from the base layer to the
+// top one. Instructions are read from the history in the image config.
+func (c *Client) Layers(ctx context.Context, repo, ref string, platform ocispec.Platform) ([]Layer, error) {
+	m, err := c.ResolveManifest(ctx, repo, ref, platform)
+	if err != nil {
+		return nil, err
+	}
+	config, err := c.GetConfig(ctx, repo, &m.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("get config: %s", err)
+	}
+	// entries of instructions like ENV or CMD do not create layers
+	var createdBy []string
+	for _, h := range config.History {
+		if !h.EmptyLayer {
+			createdBy = append(createdBy, h.CreatedBy)
+		}
+	}
+	layers := make([]Layer, len(m.Layers))
+	for i, desc := range m.Layers {
+		layers[i] = Layer{Digest: desc.Digest.String(), Size: desc.Size}
+		// the history may be missing or squashed
+		if len(createdBy) == len(m.Layers) {
+			layers[i].CreatedBy = createdBy[i]
+		}
+	}
+	return layers, nil
+}
@@ -0,0 +1,63 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestLayers(t *testing.T) {
+	t.Parallel()
+	config, _ := json.Marshal(ocispec.Image{History: []ocispec.History{
+		{CreatedBy: "/bin/sh -c #(nop) ADD file:abc in / "},
+		{CreatedBy: `/bin/sh -c #(nop)  CMD ["sh"]`, EmptyLayer: true},
+		{CreatedBy: "COPY . . # buildkit"},
+	}})
+	configDigest := digest.FromBytes(config)
+	manifest, _ := json.Marshal(Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeDockerManifest,
+		Config:        ocispec.Descriptor{MediaType: MediaTypeDockerConfig, Digest: configDigest, Size: int64(len(config))},
+		Layers: []ocispec.Descriptor{
+			{MediaType: MediaTypeDockerLayer, Digest: digest.FromString("base"), Size: 2000},
+			{MediaType: MediaTypeDockerLayer, Digest: digest.FromString("app"), Size: 300},
+		},
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/ns/app/manifests/v1":
+			w.Header().Set("Content-Type", MediaTypeDockerManifest)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifest).String())
+			_, _ = w.Write(manifest)
+		case "/v2/ns/app/blobs/" + configDigest.String():
+			_, _ = w.Write(config)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	reg := &Registry{DockerHub: &DockerHubRegistry{Server: "localhost"}}
+	c := NewClient(reg, strings.TrimPrefix(srv.URL, "http://"))
+	c.http = srv.Client()
+
+	layers, err := c.Layers(context.Background(), "ns/app", "v1", ocispec.Platform{OS: "linux", Architecture: "amd64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Layer{
+		{Digest: digest.FromString("base").String(), Size: 2000, CreatedBy: "/bin/sh -c #(nop) ADD file:abc in / "},
+		{Digest: digest.FromString("app").String(), Size: 300, CreatedBy: "COPY . . # buildkit"},
+	}
+	if !reflect.DeepEqual(layers, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, layers)
+	}
+}
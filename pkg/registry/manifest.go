@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/iftechio/jki/pkg/image"
+)
+
+// ResolvedManifest is a manifest resolved from a tag or digest.
+type ResolvedManifest struct {
+	Manifest
+	// Desc is the descriptor of the manifest.
+	Desc ocispec.Descriptor
+	// Raw is the manifest as returned by the registry.
+	Raw []byte
+	// Index is the descriptor of the manifest list the manifest was selected from, if any.
+	Index *ocispec.Descriptor
+}
+
+// Digests returns digests of both the manifest list and the manifest.
+func (m *ResolvedManifest) Digests() []string {
+	ret := []string{m.Desc.Digest.String()}
+	if m.Index != nil {
+		ret = append(ret, m.Index.Digest.String())
+	}
+	return ret
+}
+
+// ResolveManifest fetches the manifest `ref` in `repo`, selecting the one matching platform
+// from manifest lists.
+func (c *Client) ResolveManifest(ctx context.Context, repo, ref string, platform ocispec.Platform) (*ResolvedManifest, error) {
+	data, desc, err := c.GetManifest(ctx, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ResolvedManifest{Desc: desc}
+	if IsIndex(desc.MediaType) {
+		var index Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("decode index: %s", err)
+		}
+		found := false
+		for _, m := range index.Manifests {
+			if image.MatchPlatform(m.Platform, platform) {
+				ret.Index = &desc
+				data, ret.Desc, err = c.GetManifest(ctx, repo, m.Digest.String())
+				if err != nil {
+					return nil, err
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no manifest found for platform %s", image.FormatPlatform(platform))
+		}
+	}
+	ret.Raw = data
+	if err := json.Unmarshal(data, &ret.Manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %s", err)
+	}
+	return ret, nil
+}
+
+// GetConfig fetches the image config of manifest m in `repo`.
+func (c *Client) GetConfig(ctx context.Context, repo string, m *Manifest) (*ocispec.Image, error) {
+	rc, err := c.GetBlob(ctx, repo, m.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var config ocispec.Image
+	if err := json.NewDecoder(rc).Decode(&config); err != nil {
+		return nil, fmt.Errorf("decode image config: %s", err)
+	}
+	return &config, nil
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"github.com/docker/docker/api/types"
+
+	"github.com/iftechio/jki/pkg/image"
 )
 
 var (
@@ -30,6 +32,9 @@ type Registry struct {
 	AliCloudEE *AliCloudEERegistry `json:"aliyun_ee"`
 	AWS        *AWSRegistry        `json:"aws"`
 	DockerHub  *DockerHubRegistry  `json:"dockerhub"`
+
+	// CacheRepo is the repository of build cache, `{image}` is replaced with the image name.
+	CacheRepo string `json:"cache_repo"`
 }
 
 var _ Interface = (*Registry)(nil)
@@ -90,3 +95,18 @@ func (r *Registry) Verify() error {
 func (r *Registry) GetAuthConfig() (types.AuthConfig, error) {
 	return r.delegate().GetAuthConfig()
 }
+
+// NewClient returns a registry API client authenticated with r.
+func (r *Registry) NewClient() *Client {
+	img := r.Image("_", "latest")
+	return NewClient(r, img.Host())
+}
+
+// Image returns the image `repo:tag` under the prefix of r.
+func (r *Registry) Image(repo, tag string) image.Image {
+	return image.Image{
+		Domain: r.Prefix(),
+		Repo:   repo,
+		Tag:    tag,
+	}
+}
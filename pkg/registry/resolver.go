@@ -1,5 +1,9 @@
 package registry
 
+import (
+	"github.com/iftechio/jki/pkg/image"
+)
+
 type Resolver struct {
 	registries      map[string]*Registry
 	defaultRegistry string
@@ -26,3 +30,12 @@ func NewResolver(configPath string) (*Resolver, error) {
 	}
 	return &r, nil
 }
+
+// NewClient returns a registry API client for img using the credentials of the matching registry.
+func (r *Resolver) NewClient(img image.Image) (*Client, error) {
+	reg, err := r.ResolveRegistryByImage(img.String())
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(reg, img.Host()), nil
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/docker/docker/pkg/fileutils"
+)
+
+// PathSize is the size of a file, or the total size of files in a directory.
+type PathSize struct {
+	Path string
+	Size int64
+}
+
+// ContextUsage is the size of files sent as a build context.
+type ContextUsage struct {
+	Size  int64
+	Files int
+	// Dirs and LargestFiles are sorted by size in descending order
+	Dirs         []PathSize
+	LargestFiles []PathSize
+}
+
+// sortBySize sorts sizes in descending order and returns the first n.
+func sortBySize(sizes []PathSize, n int) []PathSize {
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Size != sizes[j].Size {
+			return sizes[i].Size > sizes[j].Size
+		}
+		return sizes[i].Path < sizes[j].Path
+	})
+	if len(sizes) > n {
+		sizes = sizes[:n]
+	}
+	return sizes
+}
+
+// MeasureContext walks contextDir and sums sizes of files not excluded by the dockerignore
+// patterns, the same way as they are matched when the context is sent. The top n directories and
+// files are returned.
+func MeasureContext(contextDir string, excludes []string, n int) (*ContextUsage, error) {
+	pm, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return nil, err
+	}
+	usage := &ContextUsage{}
+	var files []PathSize
+	dirs := make(map[string]int64)
+	err = filepath.Walk(contextDir, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextDir, fp)
+		if err != nil || rel == "." {
+			return err
+		}
+		skip, err := pm.Matches(rel)
+		if err != nil {
+			return err
+		}
+		if skip {
+			// files in the directory may be included again by exclusions like !dir/file
+			if info.IsDir() && !pm.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		size := info.Size()
+		usage.Size += size
+		usage.Files++
+		files = append(files, PathSize{Path: rel, Size: size})
+		for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+			dirs[dir] += size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	usage.Dirs = make([]PathSize, 0, len(dirs))
+	for dir, size := range dirs {
+		usage.Dirs = append(usage.Dirs, PathSize{Path: dir + string(filepath.Separator), Size: size})
+	}
+	usage.Dirs = sortBySize(usage.Dirs, n)
+	usage.LargestFiles = sortBySize(files, n)
+	return usage, nil
+}
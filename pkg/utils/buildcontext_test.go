@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]int) {
+	for name, size := range files {
+		fp := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMeasureContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jki-context-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]int{
+		"Dockerfile":                 10,
+		"main.go":                    100,
+		"node_modules/a/index.js":    1000,
+		"node_modules/keep/index.js": 500,
+		".git/objects/pack":          2000,
+		"web/dist/app.js":            300,
+	})
+
+	excludes, fp, err := ReadDockerIgnoreFor(dir, filepath.Join(dir, "Dockerfile"))
+	if err != nil || len(fp) != 0 || excludes != nil {
+		t.Fatalf("expected no ignore file, got: %q %q %v", fp, excludes, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(".git\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile.dockerignore"), []byte("# comment\n.git\nnode_modules\n!node_modules/keep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	excludes, fp, err = ReadDockerIgnoreFor(dir, filepath.Join(dir, "Dockerfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(fp) != "Dockerfile.dockerignore" {
+		t.Errorf("expected Dockerfile.dockerignore to be preferred, got: %s", fp)
+	}
+
+	usage, err := MeasureContext(dir, excludes, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dockerfile, Dockerfile.dockerignore, .dockerignore, main.go, node_modules/keep/index.js, web/dist/app.js
+	if usage.Files != 6 {
+		t.Errorf("wrong number of files: %d", usage.Files)
+	}
+	expectedFiles := []PathSize{
+		{Path: filepath.Join("node_modules", "keep", "index.js"), Size: 500},
+		{Path: filepath.Join("web", "dist", "app.js"), Size: 300},
+	}
+	if !reflect.DeepEqual(usage.LargestFiles, expectedFiles) {
+		t.Errorf("wrong largest files: %v", usage.LargestFiles)
+	}
+	sep := string(filepath.Separator)
+	expectedDirs := []PathSize{
+		{Path: "node_modules" + sep, Size: 500},
+		{Path: filepath.Join("node_modules", "keep") + sep, Size: 500},
+	}
+	if !reflect.DeepEqual(usage.Dirs, expectedDirs) {
+		t.Errorf("wrong largest dirs: %v", usage.Dirs)
+	}
+}
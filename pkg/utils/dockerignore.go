@@ -14,7 +14,25 @@ import (
 // as use GO's "clean" func to get the shortest/cleanest path for each.
 // Excerpt from https://github.com/docker/docker/blob/master/builder/dockerignore/dockerignore.go
 func ReadDockerIgnore(contextDir string) ([]string, error) {
-	f, err := os.Open(filepath.Join(contextDir, ".dockerignore"))
+	return readDockerIgnoreFile(filepath.Join(contextDir, ".dockerignore"))
+}
+
+// ReadDockerIgnoreFor returns patterns of `<dockerfile>.dockerignore` next to the Dockerfile if it
+// exists, or else patterns of .dockerignore in `contextDir`. The name of the ignore file read is
+// returned too, empty if neither exists.
+func ReadDockerIgnoreFor(contextDir, dockerfile string) ([]string, string, error) {
+	for _, fp := range []string{dockerfile + ".dockerignore", filepath.Join(contextDir, ".dockerignore")} {
+		if _, err := os.Stat(fp); err != nil {
+			continue
+		}
+		excludes, err := readDockerIgnoreFile(fp)
+		return excludes, fp, err
+	}
+	return nil, "", nil
+}
+
+func readDockerIgnoreFile(fp string) ([]string, error) {
+	f, err := os.Open(fp)
 	switch {
 	case os.IsNotExist(err):
 		return nil, nil
@@ -64,7 +82,7 @@ func ReadDockerIgnore(contextDir string) ([]string, error) {
 		excludes = append(excludes, pattern)
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("Error reading .dockerignore: %v", err)
+		return nil, fmt.Errorf("Error reading %s: %v", filepath.Base(fp), err)
 	}
 	return excludes, nil
 }
@@ -1,7 +1,6 @@
 package utils
 
 import (
-	"bufio"
 	"fmt"
 	"io"
 	"log"
@@ -11,8 +10,20 @@ import (
 	"strings"
 )
 
+// beforeExit are functions run by CheckError before exiting.
+var beforeExit []func()
+
+// BeforeExit registers f to run when CheckError exits on an error, since deferred functions are
+// not run then.
+func BeforeExit(f func()) {
+	beforeExit = append(beforeExit, f)
+}
+
 func CheckError(err error) {
 	if err != nil {
+		for _, f := range beforeExit {
+			f()
+		}
 		log.Fatal(err)
 	}
 }
@@ -32,27 +43,6 @@ func Prompt(hint string) string {
 	return input
 }
 
-func ExtractBaseImages(input io.Reader) ([]string, error) {
-	scanner := bufio.NewScanner(input)
-	var ret []string
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if !strings.HasPrefix(line, "FROM") {
-			continue
-		}
-		i := strings.IndexRune(line, '#')
-		if i != -1 {
-			line = line[:i]
-		}
-		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			return nil, fmt.Errorf("invalid spec: %s", line)
-		}
-		ret = append(ret, parts[1])
-	}
-	return ret, nil
-}
-
 // ConvertKVStringsToMap converts ["key=value"] to {"key":"value"}
 // Credit to https://github.com/docker/cli/blob/ebca1413117a3fcb81c89d6be226dcec74e5289f/opts/parse.go#L41
 func ConvertKVStringsToMap(values []string) map[string]string {
@@ -106,5 +96,10 @@ func SetClipboard(data string) error {
 
 // PrintInfo prints msg to console
 func PrintInfo(msg string) {
-	fmt.Printf(">>>>> %s\n", msg)
+	FprintInfo(os.Stdout, msg)
+}
+
+// FprintInfo prints msg as PrintInfo does to w.
+func FprintInfo(w io.Writer, msg string) {
+	_, _ = fmt.Fprintf(w, ">>>>> %s\n", msg)
 }